@@ -0,0 +1,67 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RpaasSLOGroupSpec defines a SLO aggregating several RpaasInstances
+type RpaasSLOGroupSpec struct {
+	// InstanceSelector selects the RpaasInstances belonging to the group, an
+	// empty selector selects no instance.
+	// +kubebuilder:validation:MinProperties=1
+	InstanceSelector metav1.LabelSelector `json:"instanceSelector"`
+
+	// Namespaces restricts the RpaasInstances to these namespaces, instances
+	// from every namespace are selected when empty.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Class is the SLO class whose availability and latency objectives apply
+	// to the aggregated SLIs of the group.
+	Class string `json:"class"`
+}
+
+// RpaasSLOGroupStatus defines the observed state of RpaasSLOGroup
+type RpaasSLOGroupStatus struct {
+	// ObservedGeneration is the most recent generation reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Members are the selected RpaasInstances, formatted as namespace/name.
+	// +optional
+	Members []string `json:"members,omitempty"`
+
+	// Excluded are the selected RpaasInstances left out of the group since
+	// they have no SLO class, whose SLIs are not recorded, formatted as
+	// namespace/name.
+	// +optional
+	Excluded []string `json:"excluded,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=slogroup
+// +kubebuilder:printcolumn:name="Class",type="string",JSONPath=".spec.class"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// RpaasSLOGroup is the Schema for the rpaasslogroups API
+type RpaasSLOGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RpaasSLOGroupSpec   `json:"spec,omitempty"`
+	Status RpaasSLOGroupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RpaasSLOGroupList contains a list of RpaasSLOGroup
+type RpaasSLOGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RpaasSLOGroup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RpaasSLOGroup{}, &RpaasSLOGroupList{})
+}
@@ -0,0 +1,138 @@
+package assign
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Selector selects RpaasInstances by tsuru team and pool, empty fields match
+// everything.
+type Selector struct {
+	Team string
+	Pool string
+}
+
+// ParseSelector parses selectors like team=x,pool=y.
+func ParseSelector(raw string) (Selector, error) {
+	selector := Selector{}
+	for _, term := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(term), "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return selector, fmt.Errorf("invalid selector term %q, expected key=value", term)
+		}
+
+		switch parts[0] {
+		case "team":
+			selector.Team = parts[1]
+		case "pool":
+			selector.Pool = parts[1]
+		default:
+			return selector, fmt.Errorf("invalid selector key %q, expected team or pool", parts[0])
+		}
+	}
+
+	return selector, nil
+}
+
+func (s Selector) match(rpaasInstance *v1alpha1.RpaasInstance) bool {
+	return (s.Team == "" || s.Team == controllers.TeamOwner(rpaasInstance)) &&
+		(s.Pool == "" || s.Pool == controllers.InstancePool(rpaasInstance.Namespace))
+}
+
+// Change is the update of the tags of an instance.
+type Change struct {
+	Instance  string `json:"instance"`
+	Namespace string `json:"namespace"`
+	OldTags   string `json:"oldTags"`
+	NewTags   string `json:"newTags"`
+}
+
+// SetClass sets the slo tag of the selected instances to class, keeping the
+// other tags. Every instance is validated before any of them is patched, and
+// none is patched on dryRun. Instances already on the class are not changed.
+func SetClass(ctx context.Context, c client.Client, selector Selector, class string, dryRun bool) ([]Change, error) {
+	class = strings.ToLower(class)
+
+	instances := v1alpha1.RpaasInstanceList{}
+	err := c.List(ctx, &instances)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(instances.Items, func(i, j int) bool {
+		if instances.Items[i].Namespace != instances.Items[j].Namespace {
+			return instances.Items[i].Namespace < instances.Items[j].Namespace
+		}
+		return instances.Items[i].Name < instances.Items[j].Name
+	})
+
+	var changes []Change
+	var originals, updated []*v1alpha1.RpaasInstance
+	for i := range instances.Items {
+		rpaasInstance := &instances.Items[i]
+		if !selector.match(rpaasInstance) {
+			continue
+		}
+
+		oldTags := rpaasInstance.Annotations[definition.TagsAnnotation]
+		newTags := definition.SetSLOClassTag(oldTags, class)
+		if newTags == oldTags {
+			continue
+		}
+
+		instance := rpaasInstance.DeepCopy()
+		if instance.Annotations == nil {
+			instance.Annotations = map[string]string{}
+		}
+		instance.Annotations[definition.TagsAnnotation] = newTags
+		if _, err = definition.SLOClass(instance); err != nil {
+			return nil, fmt.Errorf("invalid SLO class %q for %s/%s: %w", class, instance.Namespace, instance.Name, err)
+		}
+
+		changes = append(changes, Change{
+			Instance:  instance.Name,
+			Namespace: instance.Namespace,
+			OldTags:   oldTags,
+			NewTags:   newTags,
+		})
+		originals = append(originals, rpaasInstance)
+		updated = append(updated, instance)
+	}
+
+	if dryRun {
+		return changes, nil
+	}
+
+	for i, instance := range updated {
+		err = c.Patch(ctx, instance, client.MergeFrom(originals[i]))
+		if err != nil {
+			return changes[:i], fmt.Errorf("could not patch %s/%s: %w", instance.Namespace, instance.Name, err)
+		}
+	}
+
+	return changes, nil
+}
+
+// WriteDiff writes the changes as a diff of the tags annotation.
+func WriteDiff(w io.Writer, changes []Change) error {
+	for _, change := range changes {
+		_, err := fmt.Fprintf(w, "%s/%s\n- %s: %s\n+ %s: %s\n",
+			change.Namespace, change.Instance,
+			definition.TagsAnnotation, change.OldTags,
+			definition.TagsAnnotation, change.NewTags,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package assign
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newInstance(namespace, name, team, tags string) *v1alpha1.RpaasInstance {
+	return &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels: map[string]string{
+				"rpaas.extensions.tsuru.io/team-owner": team,
+			},
+			Annotations: map[string]string{
+				"rpaas.extensions.tsuru.io/tags": tags,
+			},
+		},
+	}
+}
+
+func newFakeClient() client.Client {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			newInstance("rpaasv2-fe-pool1", "instance1", "team1", "owner:x,slo:low,env=prod"),
+			newInstance("rpaasv2-fe-pool1", "instance2", "team1", ""),
+			newInstance("rpaasv2-fe-pool1", "instance3", "team1", "slo:high"),
+			newInstance("rpaasv2-fe-pool1", "instance4", "team2", "slo:low"),
+			newInstance("rpaasv2-fe-pool2", "instance5", "team1", "slo:low"),
+		).Build()
+}
+
+func tagsOf(t *testing.T, c client.Client, namespace, name string) string {
+	instance := v1alpha1.RpaasInstance{}
+	require.NoError(t, c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, &instance))
+	return instance.Annotations["rpaas.extensions.tsuru.io/tags"]
+}
+
+func TestParseSelector(t *testing.T) {
+	selector, err := ParseSelector("team=team1, pool=pool1")
+	require.NoError(t, err)
+	assert.Equal(t, Selector{Team: "team1", Pool: "pool1"}, selector)
+
+	_, err = ParseSelector("")
+	assert.EqualError(t, err, `invalid selector term "", expected key=value`)
+
+	_, err = ParseSelector("class=high")
+	assert.EqualError(t, err, `invalid selector key "class", expected team or pool`)
+}
+
+func TestSetClass(t *testing.T) {
+	ctx := context.TODO()
+	k8sClient := newFakeClient()
+
+	changes, err := SetClass(ctx, k8sClient, Selector{Team: "team1", Pool: "pool1"}, "High", false)
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Instance: "instance1", Namespace: "rpaasv2-fe-pool1", OldTags: "owner:x,slo:low,env=prod", NewTags: "owner:x,slo:high,env=prod"},
+		{Instance: "instance2", Namespace: "rpaasv2-fe-pool1", OldTags: "", NewTags: "slo:high"},
+	}, changes)
+
+	assert.Equal(t, "owner:x,slo:high,env=prod", tagsOf(t, k8sClient, "rpaasv2-fe-pool1", "instance1"))
+	assert.Equal(t, "slo:high", tagsOf(t, k8sClient, "rpaasv2-fe-pool1", "instance2"))
+	assert.Equal(t, "slo:low", tagsOf(t, k8sClient, "rpaasv2-fe-pool1", "instance4"))
+	assert.Equal(t, "slo:low", tagsOf(t, k8sClient, "rpaasv2-fe-pool2", "instance5"))
+}
+
+func TestSetClassDryRun(t *testing.T) {
+	ctx := context.TODO()
+	k8sClient := newFakeClient()
+
+	changes, err := SetClass(ctx, k8sClient, Selector{Pool: "pool2"}, "critical", true)
+	require.NoError(t, err)
+	assert.Equal(t, "slo:low", tagsOf(t, k8sClient, "rpaasv2-fe-pool2", "instance5"))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDiff(&buf, changes))
+	assert.Equal(t, `rpaasv2-fe-pool2/instance5
+- rpaas.extensions.tsuru.io/tags: slo:low
++ rpaas.extensions.tsuru.io/tags: slo:critical
+`, buf.String())
+}
+
+func TestSetClassInvalid(t *testing.T) {
+	ctx := context.TODO()
+	k8sClient := newFakeClient()
+
+	_, err := SetClass(ctx, k8sClient, Selector{Team: "team1"}, "platinum", false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid SLO class "platinum" for rpaasv2-fe-pool1/instance1`)
+	assert.Equal(t, "owner:x,slo:low,env=prod", tagsOf(t, k8sClient, "rpaasv2-fe-pool1", "instance1"))
+}
@@ -0,0 +1,338 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Status classifies the SLO of an instance.
+type Status string
+
+const (
+	// StatusNoSLO is an instance without SLOs.
+	StatusNoSLO Status = "no-slo"
+	// StatusValid is an instance whose PrometheusRules match its SLOs.
+	StatusValid Status = "valid"
+	// StatusInvalidClass is an instance with an unknown SLO class.
+	StatusInvalidClass Status = "invalid-class"
+	// StatusInvalidSLO is an instance whose SLOs cannot be generated for
+	// other reasons, eg: an invalid schedule.
+	StatusInvalidSLO Status = "invalid-slo"
+	// StatusRulesMissing is an instance without some of its PrometheusRules.
+	StatusRulesMissing Status = "rules-missing"
+	// StatusRulesStale is an instance whose PrometheusRules differ from the
+	// ones generated for its SLOs.
+	StatusRulesStale Status = "rules-stale"
+	// StatusRulesOrphaned is an instance, possibly removed, with
+	// PrometheusRules not generated for any of its SLOs.
+	StatusRulesOrphaned Status = "rules-orphaned"
+	// StatusRulesWrongNamespace is an instance with PrometheusRules out of
+	// its rules namespace.
+	StatusRulesWrongNamespace Status = "rules-wrong-namespace"
+)
+
+// Statuses are all the statuses, from the most to the least severe.
+var Statuses = []Status{
+	StatusInvalidClass,
+	StatusInvalidSLO,
+	StatusRulesWrongNamespace,
+	StatusRulesMissing,
+	StatusRulesStale,
+	StatusRulesOrphaned,
+	StatusNoSLO,
+	StatusValid,
+}
+
+// Instance is the audit of a RpaasInstance, Rules are the PrometheusRules
+// behind the status and Error the reason of invalid statuses. Removed
+// instances have no namespace.
+type Instance struct {
+	Instance  string   `json:"instance"`
+	Namespace string   `json:"namespace"`
+	Team      string   `json:"team"`
+	Pool      string   `json:"pool"`
+	Status    Status   `json:"status"`
+	Rules     []string `json:"rules,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Summary counts the instances of a team and pool by status.
+type Summary struct {
+	Team      string         `json:"team"`
+	Pool      string         `json:"pool"`
+	Instances int            `json:"instances"`
+	Statuses  map[Status]int `json:"statuses"`
+}
+
+// Report is the audit of every RpaasInstance.
+type Report struct {
+	Instances []Instance `json:"instances"`
+	Summary   []Summary  `json:"summary"`
+}
+
+// Auditor compares the PrometheusRules of the instances with the ones the
+// Reconciler would generate. Only the default rules backend without shards
+// can be audited, Audit fails when the Reconciler uses any other.
+type Auditor struct {
+	Client     client.Reader
+	Reconciler *controllers.RpaasInstanceReconciler
+}
+
+type ownerKey struct {
+	service   string
+	instance  string
+	namespace string
+}
+
+// Audit classifies every RpaasInstance, and the PrometheusRules left by
+// removed instances.
+func (a *Auditor) Audit(ctx context.Context) (*Report, error) {
+	if a.Reconciler.RulesBackend != nil || a.Reconciler.RulesShardMaxSize > 0 {
+		return nil, errors.New("only the default prometheus-rule backend without shards can be audited")
+	}
+
+	instances := v1alpha1.RpaasInstanceList{}
+	err := a.Client.List(ctx, &instances)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := monitoringv1.PrometheusRuleList{}
+	err = a.Client.List(ctx, &rules, controllers.OwnedObjectsSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	rulesByOwner := map[ownerKey][]*monitoringv1.PrometheusRule{}
+	for _, rule := range rules.Items {
+		owner := controllers.ObjectOwner(rule)
+		key := ownerKey{service: owner.Service, instance: owner.Instance}
+		rulesByOwner[key] = append(rulesByOwner[key], rule)
+	}
+
+	report := &Report{Instances: []Instance{}}
+	consumed := map[client.ObjectKey]bool{}
+	for i := range instances.Items {
+		rpaasInstance := &instances.Items[i]
+		owner := controllers.ObjectOwner(rpaasInstance)
+		key := ownerKey{service: owner.Service, instance: owner.Instance}
+
+		// same-named instances of one service share the owner labels
+		var owned []*monitoringv1.PrometheusRule
+		for _, rule := range rulesByOwner[key] {
+			if controllers.OwnedBy(rpaasInstance, rule) {
+				owned = append(owned, rule)
+				consumed[client.ObjectKeyFromObject(rule)] = true
+			}
+		}
+
+		report.Instances = append(report.Instances, a.auditInstance(ctx, rpaasInstance, owned))
+	}
+
+	orphanedByOwner := map[ownerKey][]*monitoringv1.PrometheusRule{}
+	for _, rule := range rules.Items {
+		if consumed[client.ObjectKeyFromObject(rule)] {
+			continue
+		}
+		owner := controllers.ObjectOwner(rule)
+		key := ownerKey{service: owner.Service, instance: owner.Instance, namespace: owner.Namespace}
+		orphanedByOwner[key] = append(orphanedByOwner[key], rule)
+	}
+
+	for _, orphaned := range orphanedByOwner {
+		owner := controllers.ObjectOwner(orphaned[0])
+		report.Instances = append(report.Instances, Instance{
+			Instance: owner.Instance,
+			Team:     owner.Team,
+			Pool:     owner.Pool,
+			Status:   StatusRulesOrphaned,
+			Rules:    ruleNames(orphaned),
+		})
+	}
+
+	sort.Slice(report.Instances, func(i, j int) bool {
+		a, b := report.Instances[i], report.Instances[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Instance < b.Instance
+	})
+
+	report.Summary = summarize(report.Instances)
+	return report, nil
+}
+
+func (a *Auditor) auditInstance(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, existing []*monitoringv1.PrometheusRule) Instance {
+	result := Instance{
+		Instance:  rpaasInstance.Name,
+		Namespace: rpaasInstance.Namespace,
+		Team:      controllers.TeamOwner(rpaasInstance),
+		Pool:      controllers.InstancePool(rpaasInstance.Namespace),
+	}
+
+	if err := classError(rpaasInstance); err != nil {
+		result.Status = StatusInvalidClass
+		result.Error = err.Error()
+		return result
+	}
+
+	desired, err := a.Reconciler.DesiredPrometheusRules(ctx, rpaasInstance)
+	if err != nil {
+		result.Status = StatusInvalidSLO
+		result.Error = err.Error()
+		return result
+	}
+
+	rulesNamespace := controllers.RulesNamespace(rpaasInstance.Namespace)
+	byName := map[string][]*monitoringv1.PrometheusRule{}
+	for _, rule := range existing {
+		byName[rule.Name] = append(byName[rule.Name], rule)
+	}
+
+	problems := map[Status][]string{}
+	for _, rule := range desired {
+		found := byName[rule.Name]
+		delete(byName, rule.Name)
+
+		var current *monitoringv1.PrometheusRule
+		for _, candidate := range found {
+			if candidate.Namespace == rulesNamespace {
+				current = candidate
+				continue
+			}
+			problems[StatusRulesWrongNamespace] = append(problems[StatusRulesWrongNamespace], candidate.Namespace+"/"+candidate.Name)
+		}
+
+		switch {
+		case current == nil && len(found) == 0:
+			problems[StatusRulesMissing] = append(problems[StatusRulesMissing], rulesNamespace+"/"+rule.Name)
+		case current != nil && !equality.Semantic.DeepEqual(current.Spec, rule.Spec):
+			problems[StatusRulesStale] = append(problems[StatusRulesStale], rulesNamespace+"/"+rule.Name)
+		}
+	}
+
+	for _, orphaned := range byName {
+		problems[StatusRulesOrphaned] = append(problems[StatusRulesOrphaned], ruleNames(orphaned)...)
+	}
+
+	for _, status := range Statuses {
+		if rules, found := problems[status]; found {
+			sort.Strings(rules)
+			result.Status = status
+			result.Rules = rules
+			return result
+		}
+	}
+
+	result.Status = StatusValid
+	if len(desired) == 0 {
+		result.Status = StatusNoSLO
+	}
+	return result
+}
+
+// classError returns the error of the classes of the instance that cannot be
+// found, invalid tag classes are skipped without errors by the reconciler.
+func classError(rpaasInstance *v1alpha1.RpaasInstance) error {
+	if _, err := definition.SLOClass(rpaasInstance); err != nil {
+		return err
+	}
+	if _, err := definition.LocationSLOClasses(rpaasInstance); err != nil {
+		return err
+	}
+	_, err := definition.HostSLOClasses(rpaasInstance)
+	return err
+}
+
+func ruleNames(rules []*monitoringv1.PrometheusRule) []string {
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Namespace+"/"+rule.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func summarize(instances []Instance) []Summary {
+	type teamPool struct{ team, pool string }
+
+	byTeamPool := map[teamPool]*Summary{}
+	for _, instance := range instances {
+		key := teamPool{team: instance.Team, pool: instance.Pool}
+		summary := byTeamPool[key]
+		if summary == nil {
+			summary = &Summary{Team: instance.Team, Pool: instance.Pool, Statuses: map[Status]int{}}
+			byTeamPool[key] = summary
+		}
+		summary.Instances++
+		summary.Statuses[instance.Status]++
+	}
+
+	summaries := []Summary{}
+	for _, summary := range byTeamPool {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Team != summaries[j].Team {
+			return summaries[i].Team < summaries[j].Team
+		}
+		return summaries[i].Pool < summaries[j].Pool
+	})
+
+	return summaries
+}
+
+// WriteJSON writes the report as JSON.
+func WriteJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// WriteTable writes the summary as a human readable table, followed by the
+// instances that are not valid nor without SLOs when details is set.
+func WriteTable(w io.Writer, report *Report, details bool) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	header := []string{"TEAM", "POOL", "INSTANCES"}
+	for _, status := range Statuses {
+		header = append(header, strings.ToUpper(strings.ReplaceAll(string(status), "-", " ")))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, summary := range report.Summary {
+		row := []string{summary.Team, summary.Pool, fmt.Sprint(summary.Instances)}
+		for _, status := range Statuses {
+			row = append(row, fmt.Sprint(summary.Statuses[status]))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	if details {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "INSTANCE\tTEAM\tPOOL\tSTATUS\tRULES\tERROR")
+		for _, instance := range report.Instances {
+			if instance.Status == StatusValid || instance.Status == StatusNoSLO {
+				continue
+			}
+			fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\t%s\t%s\n",
+				instance.Namespace, instance.Instance, instance.Team, instance.Pool,
+				instance.Status, strings.Join(instance.Rules, ","), instance.Error)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newInstance(name, team, tags string) *v1alpha1.RpaasInstance {
+	return &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "rpaasv2-fe-pool1",
+			Name:      name,
+			Labels: map[string]string{
+				"rpaas.extensions.tsuru.io/instance-name": name,
+				"rpaas.extensions.tsuru.io/service-name":  "rpaasv2-fe",
+				"rpaas.extensions.tsuru.io/team-owner":    team,
+			},
+			Annotations: map[string]string{
+				"rpaas.extensions.tsuru.io/tags": tags,
+			},
+		},
+	}
+}
+
+func alertsRule(t *testing.T, c client.Client, name string) *monitoringv1.PrometheusRule {
+	rule := &monitoringv1.PrometheusRule{}
+	require.NoError(t, c.Get(context.TODO(), client.ObjectKey{
+		Namespace: "tsuru-pool1",
+		Name:      "slos-alerts-tsuru.rpaasv2-fe-pool1." + name,
+	}, rule))
+	return rule
+}
+
+func TestAudit(t *testing.T) {
+	ctx := context.TODO()
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+	_ = monitoringv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	instances := []*v1alpha1.RpaasInstance{
+		newInstance("valid", "team1", "slo:high"),
+		newInstance("stale", "team1", "slo:high"),
+		newInstance("missing", "team1", "slo:high"),
+		newInstance("moved", "team1", "slo:high"),
+		newInstance("extra", "team1", "slo:high"),
+		newInstance("removed", "team1", "slo:high"),
+		newInstance("untagged", "team2", "env:prod"),
+		newInstance("invalid", "team2", "slo:platinum"),
+		newInstance("unscheduled", "team2", "slo:high"),
+	}
+	instances[8].Annotations[definition.ScheduleAnnotation] = "{"
+
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, instance := range instances {
+		builder = builder.WithRuntimeObjects(instance)
+	}
+	k8sClient := builder.Build()
+
+	reconciler := &controllers.RpaasInstanceReconciler{Client: k8sClient, Log: ctrl.Log}
+	for _, instance := range instances {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)})
+		require.NoError(t, err)
+	}
+
+	stale := alertsRule(t, k8sClient, "stale")
+	stale.Spec.Groups[0].Rules[0].Expr = intstr.FromString("vector(1)")
+	require.NoError(t, k8sClient.Update(ctx, stale))
+
+	require.NoError(t, k8sClient.Delete(ctx, alertsRule(t, k8sClient, "missing")))
+
+	moved := alertsRule(t, k8sClient, "moved")
+	require.NoError(t, k8sClient.Delete(ctx, moved))
+	moved.Namespace, moved.ResourceVersion = "tsuru-pool2", ""
+	require.NoError(t, k8sClient.Create(ctx, moved))
+
+	extra := alertsRule(t, k8sClient, "extra").DeepCopy()
+	extra.Name, extra.ResourceVersion = "slos-alerts-tsuru.rpaasv2-fe-pool1.extra.old", ""
+	require.NoError(t, k8sClient.Create(ctx, extra))
+
+	// removed without the controller, bypassing its finalizer
+	removed := &v1alpha1.RpaasInstance{}
+	require.NoError(t, k8sClient.Get(ctx, client.ObjectKeyFromObject(instances[5]), removed))
+	removed.Finalizers = nil
+	require.NoError(t, k8sClient.Update(ctx, removed))
+	require.NoError(t, k8sClient.Delete(ctx, removed))
+
+	auditor := &Auditor{Client: k8sClient, Reconciler: reconciler}
+	report, err := auditor.Audit(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Instance{
+		{Instance: "removed", Team: "team1", Pool: "pool1", Status: StatusRulesOrphaned, Rules: []string{"tsuru-pool1/slos-alerts-tsuru.rpaasv2-fe-pool1.removed"}},
+		{Instance: "extra", Namespace: "rpaasv2-fe-pool1", Team: "team1", Pool: "pool1", Status: StatusRulesOrphaned, Rules: []string{"tsuru-pool1/slos-alerts-tsuru.rpaasv2-fe-pool1.extra.old"}},
+		{Instance: "invalid", Namespace: "rpaasv2-fe-pool1", Team: "team2", Pool: "pool1", Status: StatusInvalidClass, Error: `SLO class "platinum" is not found`},
+		{Instance: "missing", Namespace: "rpaasv2-fe-pool1", Team: "team1", Pool: "pool1", Status: StatusRulesMissing, Rules: []string{"tsuru-pool1/slos-alerts-tsuru.rpaasv2-fe-pool1.missing"}},
+		{Instance: "moved", Namespace: "rpaasv2-fe-pool1", Team: "team1", Pool: "pool1", Status: StatusRulesWrongNamespace, Rules: []string{"tsuru-pool2/slos-alerts-tsuru.rpaasv2-fe-pool1.moved"}},
+		{Instance: "stale", Namespace: "rpaasv2-fe-pool1", Team: "team1", Pool: "pool1", Status: StatusRulesStale, Rules: []string{"tsuru-pool1/slos-alerts-tsuru.rpaasv2-fe-pool1.stale"}},
+		{Instance: "unscheduled", Namespace: "rpaasv2-fe-pool1", Team: "team2", Pool: "pool1", Status: StatusInvalidSLO, Error: "invalid rpaas.extensions.tsuru.io/slo-schedule annotation: unexpected end of JSON input"},
+		{Instance: "untagged", Namespace: "rpaasv2-fe-pool1", Team: "team2", Pool: "pool1", Status: StatusNoSLO},
+		{Instance: "valid", Namespace: "rpaasv2-fe-pool1", Team: "team1", Pool: "pool1", Status: StatusValid},
+	}, report.Instances)
+
+	assert.Equal(t, []Summary{
+		{Team: "team1", Pool: "pool1", Instances: 6, Statuses: map[Status]int{
+			StatusRulesOrphaned:       2,
+			StatusRulesMissing:        1,
+			StatusRulesWrongNamespace: 1,
+			StatusRulesStale:          1,
+			StatusValid:               1,
+		}},
+		{Team: "team2", Pool: "pool1", Instances: 3, Statuses: map[Status]int{
+			StatusInvalidClass: 1,
+			StatusInvalidSLO:   1,
+			StatusNoSLO:        1,
+		}},
+	}, report.Summary)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteTable(&buf, report, false))
+	assert.Equal(t, `TEAM   POOL   INSTANCES  INVALID CLASS  INVALID SLO  RULES WRONG NAMESPACE  RULES MISSING  RULES STALE  RULES ORPHANED  NO SLO  VALID
+team1  pool1  6          0              0            1                      1              1            2               0       1
+team2  pool1  3          1              1            0                      0              0            0               1       0
+`, buf.String())
+}
+
+func TestAuditRulesBackends(t *testing.T) {
+	k8sClient := fake.NewClientBuilder().Build()
+
+	auditor := &Auditor{Client: k8sClient, Reconciler: &controllers.RpaasInstanceReconciler{Client: k8sClient, RulesShardMaxSize: 1024}}
+	_, err := auditor.Audit(context.TODO())
+	assert.EqualError(t, err, "only the default prometheus-rule backend without shards can be audited")
+
+	auditor.Reconciler = &controllers.RpaasInstanceReconciler{Client: k8sClient, RulesBackend: &controllers.ConfigMapRulesBackend{Client: k8sClient}}
+	_, err = auditor.Audit(context.TODO())
+	assert.EqualError(t, err, "only the default prometheus-rule backend without shards can be audited")
+}
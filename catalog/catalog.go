@@ -0,0 +1,233 @@
+package catalog
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+)
+
+// Path is where the catalog handler is expected to be mounted.
+const Path = "/api/v1/slos"
+
+// Entry describes a SLO of a RpaasInstance, instances without SLOs are
+// listed with an empty class.
+type Entry struct {
+	Instance   string     `json:"instance"`
+	Namespace  string     `json:"namespace"`
+	Service    string     `json:"service"`
+	Team       string     `json:"team"`
+	Pool       string     `json:"pool"`
+	SLO        string     `json:"slo,omitempty"`
+	Class      string     `json:"class"`
+	Location   string     `json:"location,omitempty"`
+	Host       string     `json:"host,omitempty"`
+	Objectives Objectives `json:"objectives"`
+	Rules      []Rule     `json:"rules"`
+}
+
+type Objectives struct {
+	Availability float64            `json:"availability,omitempty"`
+	Latency      []LatencyObjective `json:"latency,omitempty"`
+}
+
+type LatencyObjective struct {
+	LE     string  `json:"le"`
+	Target float64 `json:"target"`
+}
+
+// Rule locates rules of the SLO: a PrometheusRule, possibly a shard, a rule
+// file of a ConfigMap or a rule group of the ruler API.
+type Rule struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	File      string `json:"file,omitempty"`
+}
+
+// Filter selects catalog entries, empty fields match everything.
+type Filter struct {
+	Team  string
+	Pool  string
+	Class string
+}
+
+func (f Filter) match(e Entry) bool {
+	return (f.Team == "" || f.Team == e.Team) &&
+		(f.Pool == "" || f.Pool == e.Pool) &&
+		(f.Class == "" || f.Class == e.Class)
+}
+
+// List builds the catalog of every RpaasInstance visible by the client of the
+// reconciler, out of the SLOs and rules it generates.
+func List(ctx context.Context, reconciler *controllers.RpaasInstanceReconciler, filter Filter) ([]Entry, error) {
+	instances := v1alpha1.RpaasInstanceList{}
+	err := reconciler.Client.List(ctx, &instances)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for i := range instances.Items {
+		instanceEntries, err := instanceEntries(ctx, reconciler, &instances.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range instanceEntries {
+			if filter.match(entry) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Namespace != entries[j].Namespace {
+			return entries[i].Namespace < entries[j].Namespace
+		}
+		return entries[i].Instance < entries[j].Instance
+	})
+
+	return entries, nil
+}
+
+func instanceEntries(ctx context.Context, reconciler *controllers.RpaasInstanceReconciler, rpaasInstance *v1alpha1.RpaasInstance) ([]Entry, error) {
+	base := Entry{
+		Instance:  rpaasInstance.Name,
+		Namespace: rpaasInstance.Namespace,
+		Service:   controllers.ServiceName(rpaasInstance),
+		Team:      controllers.TeamOwner(rpaasInstance),
+		Pool:      controllers.InstancePool(rpaasInstance.Namespace),
+		Rules:     []Rule{},
+	}
+
+	// invalid classes are reported by the admission webhook, the catalog
+	// only lists the SLOs that are actually generated.
+	slos, err := reconciler.GeneratedSLOs(ctx, rpaasInstance)
+	if err != nil {
+		return nil, err
+	}
+	if len(slos) == 0 {
+		return []Entry{base}, nil
+	}
+
+	var entries []Entry
+	for _, s := range slos {
+		entry := base
+		entry.SLO = s.SLO.Name
+		entry.Class = s.Class.Name
+		entry.Location = s.SLO.Labels["rpaas_location"]
+		entry.Host = s.SLO.Labels["rpaas_host"]
+		entry.Objectives.Availability = s.Class.Objectives.Availability
+		for _, latency := range s.Class.Objectives.Latency {
+			entry.Objectives.Latency = append(entry.Objectives.Latency, LatencyObjective{
+				LE:     latency.LE,
+				Target: latency.Target,
+			})
+		}
+
+		entry.Rules = []Rule{}
+		for _, rule := range s.Rules {
+			entry.Rules = append(entry.Rules, Rule{
+				Kind:      rule.Kind,
+				Name:      rule.Name,
+				Namespace: rule.Namespace,
+				File:      rule.File,
+			})
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// NewHandler returns a read-only HTTP handler listing the SLO catalog as JSON
+// or, using the "format=csv" query string, as CSV. Entries may be filtered
+// using the "team", "pool" and "class" query strings.
+func NewHandler(reconciler *controllers.RpaasInstanceReconciler, log logr.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		entries, err := List(r.Context(), reconciler, Filter{
+			Team:  query.Get("team"),
+			Pool:  query.Get("pool"),
+			Class: query.Get("class"),
+		})
+		if err != nil {
+			log.Error(err, "could not list SLO catalog")
+			http.Error(w, "could not list SLO catalog", http.StatusInternalServerError)
+			return
+		}
+
+		switch query.Get("format") {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(entries)
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			err = WriteCSV(w, entries)
+		default:
+			http.Error(w, fmt.Sprintf("unsupported format %q", query.Get("format")), http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			log.Error(err, "could not write SLO catalog")
+		}
+	})
+}
+
+// WriteCSV writes the entries as CSV, latency objectives are formatted as
+// "<le>:<target>" and rules as "<namespace>/<name>", followed by ":<file>" for
+// rule files, both separated by ";".
+func WriteCSV(w io.Writer, entries []Entry) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"instance", "namespace", "service", "team", "pool", "slo", "class", "location", "host", "availability", "latency", "rules"})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		var latency, rules []string
+		for _, l := range e.Objectives.Latency {
+			latency = append(latency, l.LE+":"+strconv.FormatFloat(l.Target, 'f', -1, 64))
+		}
+		for _, r := range e.Rules {
+			rule := r.Namespace + "/" + r.Name
+			if r.File != "" {
+				rule += ":" + r.File
+			}
+			rules = append(rules, rule)
+		}
+
+		availability := ""
+		if e.Objectives.Availability > 0 {
+			availability = strconv.FormatFloat(e.Objectives.Availability, 'f', -1, 64)
+		}
+
+		err = writer.Write([]string{
+			e.Instance, e.Namespace, e.Service, e.Team, e.Pool, e.SLO, e.Class, e.Location, e.Host,
+			availability, strings.Join(latency, ";"), strings.Join(rules, ";"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
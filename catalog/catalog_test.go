@@ -0,0 +1,205 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newReconciler(builder *fake.ClientBuilder) *controllers.RpaasInstanceReconciler {
+	return &controllers.RpaasInstanceReconciler{
+		Client: builder.Build(),
+		Log:    ctrl.Log,
+	}
+}
+
+func newFakeReader() *fake.ClientBuilder {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+	_ = monitoringv1.AddToScheme(scheme)
+
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			&v1alpha1.RpaasInstance{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "rpaasv2-fe-mypool",
+					Name:      "instance1",
+					Labels: map[string]string{
+						"rpaas.extensions.tsuru.io/team-owner":    "team-a",
+						"rpaas.extensions.tsuru.io/service-name":  "rpaasv2",
+						"rpaas.extensions.tsuru.io/instance-name": "instance1",
+					},
+					Annotations: map[string]string{
+						"rpaas.extensions.tsuru.io/tags": "slo:critical",
+					},
+				},
+			},
+			&v1alpha1.RpaasInstance{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "instance2",
+					Labels: map[string]string{
+						"rpaas.extensions.tsuru.io/team-owner":    "team-b",
+						"rpaas.extensions.tsuru.io/service-name":  "rpaasv2",
+						"rpaas.extensions.tsuru.io/instance-name": "instance2",
+					},
+					Annotations: map[string]string{
+						"rpaas.extensions.tsuru.io/tags": "slo:low",
+					},
+				},
+			},
+			&v1alpha1.RpaasInstance{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "instance3",
+					Labels: map[string]string{
+						"rpaas.extensions.tsuru.io/team-owner": "team-b",
+					},
+				},
+			},
+		)
+}
+
+func TestHandlerJSON(t *testing.T) {
+	handler := NewHandler(newReconciler(newFakeReader()), ctrl.Log)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, Path+"?team=team-a", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `[
+		{
+			"instance": "instance1",
+			"namespace": "rpaasv2-fe-mypool",
+			"service": "rpaasv2",
+			"team": "team-a",
+			"pool": "mypool",
+			"slo": "tsuru.rpaasv2-fe-mypool.instance1",
+			"class": "critical",
+			"objectives": {
+				"availability": 99.99,
+				"latency": [{"le": "0.200", "target": 99}, {"le": "0.100", "target": 95}]
+			},
+			"rules": [{"kind": "PrometheusRule", "name": "slos-alerts-tsuru.rpaasv2-fe-mypool.instance1", "namespace": "tsuru-mypool"}]
+		}
+	]`, recorder.Body.String())
+}
+
+func TestHandlerCSV(t *testing.T) {
+	handler := NewHandler(newReconciler(newFakeReader()), ctrl.Log)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, Path+"?format=csv&team=team-b", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `instance,namespace,service,team,pool,slo,class,location,host,availability,latency,rules
+instance2,default,rpaasv2,team-b,,tsuru.default.instance2,low,,,98,,default/slos-alerts-tsuru.default.instance2
+instance3,default,,team-b,,,,,,,,
+`, recorder.Body.String())
+}
+
+func TestHandlerFilterByClass(t *testing.T) {
+	handler := NewHandler(newReconciler(newFakeReader()), ctrl.Log)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, Path+"?class=low&pool=mypool", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `[]`, recorder.Body.String())
+}
+
+func TestHandlerInvalidRequests(t *testing.T) {
+	handler := NewHandler(newReconciler(newFakeReader()), ctrl.Log)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, Path+"?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestListRecordedNamespace(t *testing.T) {
+	reconciler := newReconciler(newFakeReader().WithRuntimeObjects(&v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "rpaasv2-be-otherpool",
+			Name:      "instance4",
+			Labels: map[string]string{
+				"rpaas.extensions.tsuru.io/team-owner": "team-c",
+			},
+			Annotations: map[string]string{
+				"rpaas.extensions.tsuru.io/tags": "slo:low",
+				"slo.tsuru.io/rules-namespace":   "tsuru-oldpool",
+			},
+		},
+	}))
+
+	entries, err := List(context.TODO(), reconciler, Filter{Team: "team-c"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []Rule{
+		{Kind: "PrometheusRule", Name: "slos-alerts-tsuru.rpaasv2-be-otherpool.instance4", Namespace: "tsuru-oldpool"},
+	}, entries[0].Rules)
+}
+
+func TestListShards(t *testing.T) {
+	reconciler := newReconciler(newFakeReader().WithRuntimeObjects(
+		&monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "slos-shard-0",
+				Labels:    map[string]string{"slo.tsuru.io/rules-shard": "true"},
+			},
+			Spec: monitoringv1.PrometheusRuleSpec{
+				Groups: []monitoringv1.RuleGroup{{Name: "default/other/slo:tsuru.default.other:alert"}},
+			},
+		},
+		&monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "slos-shard-1",
+				Labels:    map[string]string{"slo.tsuru.io/rules-shard": "true"},
+			},
+			Spec: monitoringv1.PrometheusRuleSpec{
+				Groups: []monitoringv1.RuleGroup{{Name: "default/instance2/slo:tsuru.default.instance2:alert"}},
+			},
+		},
+	))
+	reconciler.RulesShardMaxSize = 10
+
+	entries, err := List(context.TODO(), reconciler, Filter{Class: "low"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []Rule{
+		{Kind: "PrometheusRule", Name: "slos-shard-1", Namespace: "default"},
+	}, entries[0].Rules)
+}
+
+func TestListConfigMapBackend(t *testing.T) {
+	reconciler := newReconciler(newFakeReader())
+	reconciler.RulesBackend = &controllers.ConfigMapRulesBackend{Client: reconciler.Client, Log: ctrl.Log}
+
+	entries, err := List(context.TODO(), reconciler, Filter{Class: "low"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []Rule{
+		{Kind: "ConfigMap", Name: "slo-rules-tsuru.default.instance2", Namespace: "default", File: "slos-alerts-tsuru.default.instance2.yaml"},
+	}, entries[0].Rules)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, entries))
+	assert.Contains(t, buf.String(), "default/slo-rules-tsuru.default.instance2:slos-alerts-tsuru.default.instance2.yaml")
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// cacheSyncTimeout is how long the readiness check waits for the informers.
+const cacheSyncTimeout = time.Second
+
+// CacheSyncCheck is ready once the informers of the cache are synced.
+func CacheSyncCheck(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+		defer cancel()
+
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("informers not synced yet")
+		}
+		return nil
+	}
+}
+
+// TemplatesCheck fails when the alert templates or the PrometheusRule label
+// templates cannot be executed for a sample instance.
+func (r *RpaasInstanceReconciler) TemplatesCheck(_ *http.Request) error {
+	sample := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "rpaasv2-fe-pool",
+			Name:      "instance",
+			Labels: map[string]string{
+				rpaasInstanceNameAnnotation: "instance",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+				rpaasTeamOwnerAnnotation:    "team",
+			},
+		},
+	}
+
+	if r.AlertLinkTemplate != nil {
+		if err := r.AlertLinkTemplate.Execute(ioutil.Discard, sample); err != nil {
+			return fmt.Errorf("invalid alert link template: %w", err)
+		}
+	}
+
+	if r.AlertMessageTemplate != nil {
+		if err := r.AlertMessageTemplate.Execute(ioutil.Discard, sample); err != nil {
+			return fmt.Errorf("invalid alert message template: %w", err)
+		}
+	}
+
+	data := RuleLabelsData{Pool: "pool", Namespace: "tsuru-pool", Class: "critical", Team: "team"}
+	for key, tpl := range r.RuleLabels {
+		if err := tpl.Execute(ioutil.Discard, data); err != nil {
+			return fmt.Errorf("invalid template of PrometheusRule label %q: %w", key, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplatesCheck(t *testing.T) {
+	ruleLabels, err := ParseRuleLabels(map[string]string{"prometheus": "pool-{{ .Pool }}"})
+	require.NoError(t, err)
+
+	reconciler := &RpaasInstanceReconciler{
+		AlertLinkTemplate:    template.Must(template.New("link").Parse("http://grafana.com/blah?var-instance={{ .Name }}")),
+		AlertMessageTemplate: template.Must(template.New("message").Parse("{{ .Name }} is out of SLO")),
+		RuleLabels:           ruleLabels,
+	}
+	assert.NoError(t, reconciler.TemplatesCheck(&http.Request{}))
+
+	reconciler.AlertMessageTemplate = template.Must(template.New("message").Parse("{{ .Unknown }} is out of SLO"))
+	assert.EqualError(t, reconciler.TemplatesCheck(&http.Request{}), `invalid alert message template: template: message:1:3: executing "message" at <.Unknown>: can't evaluate field Unknown in type *v1alpha1.RpaasInstance`)
+
+	reconciler.AlertMessageTemplate = nil
+	reconciler.RuleLabels, err = ParseRuleLabels(map[string]string{"prometheus": "{{ .Tier }}"})
+	require.NoError(t, err)
+	assert.Error(t, reconciler.TemplatesCheck(&http.Request{}))
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DependsOnAnnotation holds the comma separated instances an instance
+// depends on, as namespace/name or just name for instances of the same
+// namespace, eg: "rpaasv2-be-pool1/checkout,search".
+const DependsOnAnnotation = "rpaas.extensions.tsuru.io/slo-depends-on"
+
+// reconcileInhibition keeps an AlertmanagerConfig inhibiting the alerts of
+// the SLOs while the alerts of the instances they depend on are firing.
+func (r *RpaasInstanceReconciler) reconcileInhibition(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, slos []InstanceSLO) error {
+	namespace := rulesNamespace(ctx, rpaasInstance)
+
+	var desired []client.Object
+	if len(slos) > 0 {
+		dependencies, err := r.dependencies(ctx, rpaasInstance)
+		if err != nil {
+			return err
+		}
+
+		if config := inhibitionConfig(rpaasInstance, dependencies, slos); config != nil {
+			desired = append(desired, config)
+		}
+	}
+
+	return r.reconcileObjects(ctx, rpaasInstance, namespace, &monitoringv1alpha1.AlertmanagerConfigList{}, desired)
+}
+
+// dependencies returns the instances declared on DependsOnAnnotation along
+// with the backend of a frontend instance, ie: the instance with the same
+// name on the rpaasv2-be namespace of the pool. Only instances whose rules
+// live on the same namespace are returned, since Alertmanager inhibitions
+// are restricted to the namespace of the AlertmanagerConfig. The backend is
+// read through APIReader, since its namespace is usually out of the cached
+// namespaces, and is not a dependency when it cannot be read.
+func (r *RpaasInstanceReconciler) dependencies(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) ([]types.NamespacedName, error) {
+	log := r.logger(ctx)
+
+	var dependencies []types.NamespacedName
+	seen := map[types.NamespacedName]bool{}
+	add := func(dependency types.NamespacedName) {
+		if seen[dependency] {
+			return
+		}
+		seen[dependency] = true
+
+		if implicitNamespace(dependency.Namespace) != implicitNamespace(rpaasInstance.Namespace) {
+			log.Info("ignoring dependency whose rules live on another namespace",
+				"dependency", dependency.String(),
+			)
+			return
+		}
+		dependencies = append(dependencies, dependency)
+	}
+
+	for _, raw := range strings.Split(rpaasInstance.Annotations[DependsOnAnnotation], ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		dependency := types.NamespacedName{Namespace: rpaasInstance.Namespace, Name: raw}
+		if parts := strings.SplitN(raw, "/", 2); len(parts) == 2 {
+			dependency = types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+		}
+		add(dependency)
+	}
+
+	if backend := backendOf(rpaasInstance.Namespace, rpaasInstance.Name); backend != nil {
+		err := r.apiReader().Get(ctx, *backend, &v1alpha1.RpaasInstance{})
+		switch {
+		case err == nil:
+			add(*backend)
+		case k8sErrors.IsForbidden(err):
+			log.Info("ignoring backend that cannot be read",
+				"dependency", backend.String(),
+				"error", err.Error(),
+			)
+		case !k8sErrors.IsNotFound(err):
+			return nil, err
+		}
+	}
+
+	return dependencies, nil
+}
+
+func (r *RpaasInstanceReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+
+	return r.Client
+}
+
+// backendOf returns the backend matching a frontend instance, nil is
+// returned for instances out of the rpaasv2-fe namespaces.
+func backendOf(namespace, name string) *types.NamespacedName {
+	if !strings.HasPrefix(namespace, "rpaasv2-fe-") {
+		return nil
+	}
+
+	return &types.NamespacedName{
+		Namespace: "rpaasv2-be-" + implicitPool(namespace),
+		Name:      name,
+	}
+}
+
+// frontendsOf maps a backend instance to its frontend, so the inhibition of
+// the frontend is updated when the backend is created or deleted.
+func frontendsOf(obj client.Object) []reconcile.Request {
+	if !strings.HasPrefix(obj.GetNamespace(), "rpaasv2-be-") {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Namespace: "rpaasv2-fe-" + implicitPool(obj.GetNamespace()),
+				Name:      obj.GetName(),
+			},
+		},
+	}
+}
+
+// inhibitionConfig returns an AlertmanagerConfig inhibiting the alerts of the
+// SLOs while alerts with the same severity of the dependencies are firing,
+// nil is returned when there are no dependencies.
+func inhibitionConfig(rpaasInstance *v1alpha1.RpaasInstance, dependencies []types.NamespacedName, slos []InstanceSLO) *monitoringv1alpha1.AlertmanagerConfig {
+	if len(dependencies) == 0 {
+		return nil
+	}
+
+	var targets []string
+	for _, s := range slos {
+		targets = append(targets, regexp.QuoteMeta(s.SLO.Name))
+	}
+
+	config := &monitoringv1alpha1.AlertmanagerConfig{}
+	config.Name = "slo-inhibitions-" + InstanceSLOName(rpaasInstance)
+	config.Spec.Receivers = []monitoringv1alpha1.Receiver{}
+
+	for _, dependency := range dependencies {
+		config.Spec.InhibitRules = append(config.Spec.InhibitRules, monitoringv1alpha1.InhibitRule{
+			SourceMatch: []monitoringv1alpha1.Matcher{
+				{
+					Name:  "service",
+					Value: sloName(dependency.Namespace, dependency.Name),
+				},
+			},
+			TargetMatch: []monitoringv1alpha1.Matcher{
+				{
+					Name:  "service",
+					Value: strings.Join(targets, "|"),
+					Regex: true,
+				},
+			},
+			Equal: []string{"severity"},
+		})
+	}
+
+	return config
+}
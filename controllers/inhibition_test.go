@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func init() {
+	_ = monitoringv1alpha1.AddToScheme(scheme)
+}
+
+func TestReconcileRpaasInstanceAlertInhibition(t *testing.T) {
+	ctx := context.TODO()
+	instance := func(namespace, name, tags string) *v1alpha1.RpaasInstance {
+		return &v1alpha1.RpaasInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Labels: map[string]string{
+					rpaasInstanceNameAnnotation: name,
+					rpaasServiceNameAnnotation:  "rpaasv2",
+				},
+				Annotations: map[string]string{
+					rpaasTagsAnnotation: tags,
+				},
+			},
+		}
+	}
+
+	frontend := instance("rpaasv2-fe-pool1", "checkout", "slo:critical")
+	frontend.Annotations[DependsOnAnnotation] = "rpaasv2-be-pool1/payments, rpaasv2-be-pool2/other"
+	frontend.Annotations["rpaas.extensions.tsuru.io/slo-hosts"] = `{"www.example.com": "high"}`
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			frontend,
+			instance("rpaasv2-be-pool1", "checkout", "slo:high"),
+		).Build()
+	reconciler := &RpaasInstanceReconciler{
+		AlertInhibition: true,
+		Client:          k8sClient,
+		Log:             ctrl.Log,
+	}
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "rpaasv2-fe-pool1",
+			Name:      "checkout",
+		},
+	}
+	_, err := reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	config := monitoringv1alpha1.AlertmanagerConfig{}
+	key := client.ObjectKey{
+		Namespace: "tsuru-pool1",
+		Name:      "slo-inhibitions-tsuru.rpaasv2-fe-pool1.checkout",
+	}
+	err = k8sClient.Get(ctx, key, &config)
+	require.NoError(t, err)
+	assert.Equal(t, "checkout", config.Labels[rpaasInstanceNameAnnotation])
+
+	target := []monitoringv1alpha1.Matcher{
+		{Name: "service", Value: `tsuru\.rpaasv2-fe-pool1\.checkout|tsuru\.rpaasv2-fe-pool1\.checkout\.host\.www\.example\.com`, Regex: true},
+	}
+	assert.Equal(t, []monitoringv1alpha1.InhibitRule{
+		{
+			SourceMatch: []monitoringv1alpha1.Matcher{{Name: "service", Value: "tsuru.rpaasv2-be-pool1.payments"}},
+			TargetMatch: target,
+			Equal:       []string{"severity"},
+		},
+		{
+			SourceMatch: []monitoringv1alpha1.Matcher{{Name: "service", Value: "tsuru.rpaasv2-be-pool1.checkout"}},
+			TargetMatch: target,
+			Equal:       []string{"severity"},
+		},
+	}, config.Spec.InhibitRules)
+
+	assert.Equal(t, []ctrl.Request{request}, frontendsOf(instance("rpaasv2-be-pool1", "checkout", "")))
+	assert.Empty(t, frontendsOf(frontend))
+
+	require.NoError(t, k8sClient.Get(ctx, client.ObjectKeyFromObject(frontend), frontend))
+	frontend.Annotations[rpaasTagsAnnotation] = ""
+	frontend.Annotations["rpaas.extensions.tsuru.io/slo-hosts"] = ""
+	err = k8sClient.Update(ctx, frontend)
+	require.NoError(t, err)
+
+	_, err = reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, key, &config)
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+// namespacedCacheClient reads the objects of the given namespaces from the
+// wrapped client, and the others from a namespace-scoped cache, as the
+// client of a manager started with --namespace.
+type namespacedCacheClient struct {
+	client.Client
+	namespaces []string
+	cache      cache.Cache
+}
+
+func newNamespacedCacheClient(t *testing.T, c client.Client, namespaces []string) *namespacedCacheClient {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{v1alpha1.GroupVersion})
+	mapper.Add(v1alpha1.GroupVersion.WithKind("RpaasInstance"), meta.RESTScopeNamespace)
+
+	namespacedCache, err := cache.MultiNamespacedCacheBuilder(namespaces)(&rest.Config{Host: "http://127.0.0.1:0"}, cache.Options{
+		Scheme: scheme,
+		Mapper: mapper,
+	})
+	require.NoError(t, err)
+
+	return &namespacedCacheClient{Client: c, namespaces: namespaces, cache: namespacedCache}
+}
+
+func (c *namespacedCacheClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	for _, namespace := range c.namespaces {
+		if namespace == key.Namespace {
+			return c.Client.Get(ctx, key, obj)
+		}
+	}
+
+	return c.cache.Get(ctx, key, obj)
+}
+
+// List only returns the objects of the given namespaces, as a
+// namespace-scoped cache listing all namespaces.
+func (c *namespacedCacheClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	err := c.Client.List(ctx, list, opts...)
+	if err != nil {
+		return err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	var cached []runtime.Object
+	for _, item := range items {
+		object, ok := item.(client.Object)
+		if !ok {
+			continue
+		}
+		for _, namespace := range c.namespaces {
+			if namespace == object.GetNamespace() {
+				cached = append(cached, item)
+			}
+		}
+	}
+	return meta.SetList(list, cached)
+}
+
+// forbiddenReader cannot read any object.
+type forbiddenReader struct {
+	client.Reader
+}
+
+func (forbiddenReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	return k8sErrors.NewForbidden(schema.GroupResource{Group: v1alpha1.GroupVersion.Group, Resource: "rpaasinstances"}, key.Name, nil)
+}
+
+func TestReconcileRpaasInstanceAlertInhibitionNamespacedCache(t *testing.T) {
+	ctx := context.TODO()
+	instance := func(namespace, name string) *v1alpha1.RpaasInstance {
+		return &v1alpha1.RpaasInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Labels: map[string]string{
+					rpaasInstanceNameAnnotation: name,
+					rpaasServiceNameAnnotation:  "rpaasv2",
+				},
+				Annotations: map[string]string{
+					rpaasTagsAnnotation: "slo:critical",
+				},
+			},
+		}
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			instance("rpaasv2-fe-pool1", "checkout"),
+			instance("rpaasv2-be-pool1", "checkout"),
+		).Build()
+
+	// the manager only watches the frontend namespace
+	scopedClient := newNamespacedCacheClient(t, k8sClient, CacheNamespaces([]string{"rpaasv2-fe-pool1"}))
+	err := scopedClient.Get(ctx, client.ObjectKey{Namespace: "rpaasv2-be-pool1", Name: "checkout"}, &v1alpha1.RpaasInstance{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown namespace for the cache")
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "rpaasv2-fe-pool1",
+			Name:      "checkout",
+		},
+	}
+	key := client.ObjectKey{
+		Namespace: "tsuru-pool1",
+		Name:      "slo-inhibitions-tsuru.rpaasv2-fe-pool1.checkout",
+	}
+
+	reconciler := &RpaasInstanceReconciler{
+		AlertInhibition: true,
+		APIReader:       k8sClient,
+		Client:          scopedClient,
+		Log:             ctrl.Log,
+	}
+	_, err = reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	config := monitoringv1alpha1.AlertmanagerConfig{}
+	err = k8sClient.Get(ctx, key, &config)
+	require.NoError(t, err)
+	require.Len(t, config.Spec.InhibitRules, 1)
+	assert.Equal(t, "tsuru.rpaasv2-be-pool1.checkout", config.Spec.InhibitRules[0].SourceMatch[0].Value)
+
+	reconciler.APIReader = forbiddenReader{}
+	_, err = reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, key, &config)
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+)
+
+// logger returns the logger of the current reconcile, holding the instance,
+// namespace and reconcileID keys, or r.Log out of a reconcile.
+func (r *RpaasInstanceReconciler) logger(ctx context.Context) logr.Logger {
+	return loggerFrom(ctx, r.Log)
+}
+
+func loggerFrom(ctx context.Context, fallback logr.Logger) logr.Logger {
+	if log := logr.FromContext(ctx); log != nil {
+		return log
+	}
+	return fallback
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestReconcileLogsInstance(t *testing.T) {
+	rpaasInstance1 := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Annotations: map[string]string{
+				rpaasTagsAnnotation: "slo:critical",
+			},
+		},
+	}
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	reconciler := &RpaasInstanceReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithRuntimeObjects(rpaasInstance1).Build(),
+		Log: zap.New(zap.RawZapOpts(uberzap.WrapCore(func(zapcore.Core) zapcore.Core { return core }))),
+	}
+
+	_, err := reconciler.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(rpaasInstance1)})
+	require.NoError(t, err)
+
+	created := logs.FilterMessage("created PrometheusRule").All()
+	require.Len(t, created, 1)
+	fields := created[0].ContextMap()
+	assert.Equal(t, "instance1", fields["instance"])
+	assert.Equal(t, "default", fields["namespace"])
+	assert.Equal(t, "critical", fields["class"])
+	assert.NotEmpty(t, fields["reconcileID"])
+}
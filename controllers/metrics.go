@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	deprecatedClassMigrations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpaas_slo_deprecated_class_migrations",
+		Help: "Number of deprecated classes of SLOs, or of their schedules, currently generated with their replacements.",
+	}, []string{"class", "replacement"})
+
+	filteredEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpaas_slo_filtered_events_total",
+		Help: "Number of RpaasInstance events ignored for not changing any field relevant to SLOs.",
+	}, []string{"event"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(deprecatedClassMigrations, filteredEvents)
+}
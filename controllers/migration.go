@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// migrateDeprecatedClasses replaces the deprecated classes of the SLOs and
+// of their schedules by their replacements, keeping the replaced classes on
+// DeprecatedClasses.
+func migrateDeprecatedClasses(slos []InstanceSLO) []InstanceSLO {
+	result := make([]InstanceSLO, 0, len(slos))
+	for _, s := range slos {
+		if replacement := definition.Replacement(s.Class); replacement != nil {
+			s.DeprecatedClasses = append(s.DeprecatedClasses, s.Class)
+			s.Class = replacement
+			s.SLO.Class = replacement.Name
+
+			labels := map[string]string{}
+			for key, value := range s.SLO.Labels {
+				labels[key] = value
+			}
+			labels["slo_class"] = replacement.Name
+			s.SLO.Labels = labels
+		}
+
+		if s.Schedule != nil {
+			schedule := *s.Schedule
+			schedule.Windows = make([]definition.ScheduleWindow, len(s.Schedule.Windows))
+			for i, window := range s.Schedule.Windows {
+				if replacement := definition.Replacement(window.Class); replacement != nil {
+					s.DeprecatedClasses = append(s.DeprecatedClasses, window.Class)
+					window.Class = replacement
+				}
+				schedule.Windows[i] = window
+			}
+			s.Schedule = &schedule
+		}
+
+		result = append(result, s)
+	}
+
+	return result
+}
+
+// classMigrations holds the deprecated classes replaced on the SLOs of each
+// instance.
+type classMigrations struct {
+	mu        sync.Mutex
+	instances map[types.NamespacedName]map[classMigration]bool
+}
+
+type classMigration struct {
+	slo         string
+	class       string
+	replacement string
+}
+
+// recordClassMigrations tracks the SLOs of the instance migrated from their
+// deprecated classes on the deprecatedClassMigrations gauge, emitting
+// SLOClassMigrated events only for the SLOs newly migrated. A nil slos stands
+// for an instance without SLOs.
+func (r *RpaasInstanceReconciler) recordClassMigrations(rpaasInstance *v1alpha1.RpaasInstance, slos []InstanceSLO) {
+	current := map[classMigration]bool{}
+	for _, s := range slos {
+		for _, class := range s.DeprecatedClasses {
+			current[classMigration{slo: s.SLO.Name, class: class.Name, replacement: definition.Replacement(class).Name}] = true
+		}
+	}
+
+	r.migrations.mu.Lock()
+	defer r.migrations.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: rpaasInstance.Namespace, Name: rpaasInstance.Name}
+	previous := r.migrations.instances[key]
+
+	for migration := range previous {
+		if !current[migration] {
+			deprecatedClassMigrations.WithLabelValues(migration.class, migration.replacement).Dec()
+		}
+	}
+
+	for migration := range current {
+		if previous[migration] {
+			continue
+		}
+		deprecatedClassMigrations.WithLabelValues(migration.class, migration.replacement).Inc()
+		if r.Recorder != nil {
+			r.Recorder.Event(rpaasInstance, corev1.EventTypeNormal, "SLOClassMigrated",
+				fmt.Sprintf("SLO %s uses the deprecated class %q, generated with %q instead", migration.slo, migration.class, migration.replacement))
+		}
+	}
+
+	if len(current) == 0 {
+		delete(r.migrations.instances, key)
+		return
+	}
+	if r.migrations.instances == nil {
+		r.migrations.instances = map[types.NamespacedName]map[classMigration]bool{}
+	}
+	r.migrations.instances[key] = current
+}
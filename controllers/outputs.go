@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// OutputPrometheusRules generates PrometheusRules using slo-generator.
+	OutputPrometheusRules = "prometheus-rules"
+	// OutputOpenSLO generates ConfigMaps holding OpenSLO SLI/SLO documents.
+	OutputOpenSLO = "openslo"
+	// OutputSloth generates Sloth PrometheusServiceLevel objects.
+	OutputSloth = "sloth"
+
+	openSLOConfigMapKey = "openslo.yaml"
+	defaultSLOWindow    = model.Duration(30 * 24 * time.Hour)
+)
+
+// OutputModes are all the supported output modes.
+var OutputModes = []string{OutputPrometheusRules, OutputOpenSLO, OutputSloth}
+
+var slothServiceLevelGVK = schema.GroupVersionKind{
+	Group:   "sloth.slok.dev",
+	Version: "v1",
+	Kind:    "PrometheusServiceLevel",
+}
+
+func (r *RpaasInstanceReconciler) outputEnabled(mode string) bool {
+	if len(r.OutputModes) == 0 {
+		return mode == OutputPrometheusRules
+	}
+
+	for _, m := range r.OutputModes {
+		if m == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reconcileOutputs keeps the documents of the enabled output modes, except
+// PrometheusRules, in sync with the given SLOs. The documents of disabled
+// output modes are removed.
+func (r *RpaasInstanceReconciler) reconcileOutputs(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, slos []InstanceSLO) error {
+	namespace := rulesNamespace(ctx, rpaasInstance)
+
+	var openSLODesired []client.Object
+	if r.outputEnabled(OutputOpenSLO) {
+		for _, s := range slos {
+			configMap, err := openSLOConfigMap(s)
+			if err != nil {
+				return err
+			}
+			openSLODesired = append(openSLODesired, configMap)
+		}
+	}
+
+	err := r.reconcileObjects(ctx, rpaasInstance, namespace, &corev1.ConfigMapList{}, openSLODesired)
+	if err != nil {
+		return err
+	}
+
+	var slothDesired []client.Object
+	if r.outputEnabled(OutputSloth) {
+		for _, s := range slos {
+			slothDesired = append(slothDesired, slothServiceLevel(s, !r.outputEnabled(OutputPrometheusRules)))
+		}
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(slothServiceLevelGVK.GroupVersion().WithKind(slothServiceLevelGVK.Kind + "List"))
+	err = r.reconcileObjects(ctx, rpaasInstance, namespace, list, slothDesired)
+	if err != nil {
+		return err
+	}
+
+	if r.AlertInhibition {
+		err := r.reconcileInhibition(ctx, rpaasInstance, slos)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcileObjects creates or updates the desired objects and removes the
+// objects of the same kind, owned by the instance, that are not desired anymore.
+// Kinds not installed on the cluster are ignored when no object is desired.
+func (r *RpaasInstanceReconciler) reconcileObjects(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, namespace string, list client.ObjectList, desired []client.Object) error {
+	log := r.logger(ctx)
+
+	err := r.Client.List(ctx, list, client.InNamespace(namespace), ownerLabels(rpaasInstance))
+	if meta.IsNoMatchError(err) && len(desired) == 0 {
+		return nil
+	}
+	if err != nil {
+		log.Error(err, "could not list objects",
+			"kind", fmt.Sprintf("%T", list),
+			"rulesNamespace", namespace,
+		)
+		return err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	existing := map[string]client.Object{}
+	for _, item := range items {
+		obj := item.(client.Object)
+		// rule files are kept by ConfigMapRulesBackend
+		if obj.GetLabels()[rulesFilesLabel] != "" || !OwnedBy(rpaasInstance, obj) {
+			continue
+		}
+		existing[obj.GetName()] = obj
+	}
+
+	for _, obj := range desired {
+		obj.SetNamespace(namespace)
+		obj.SetLabels(ownedObjectLabels(rpaasInstance, obj.GetLabels()))
+		obj.SetOwnerReferences(ownerReferences(rpaasInstance, namespace))
+
+		current, found := existing[obj.GetName()]
+		if !found {
+			err = r.Client.Create(ctx, obj)
+			if err != nil {
+				log.Error(err, "could not create object",
+					"kind", fmt.Sprintf("%T", obj),
+					"object", obj.GetName(),
+					"rulesNamespace", namespace,
+				)
+				return err
+			}
+			continue
+		}
+
+		delete(existing, obj.GetName())
+		obj.SetResourceVersion(current.GetResourceVersion())
+		err = r.Client.Update(ctx, obj)
+		if err != nil {
+			log.Error(err, "could not update object",
+				"kind", fmt.Sprintf("%T", obj),
+				"object", obj.GetName(),
+				"rulesNamespace", namespace,
+			)
+			return err
+		}
+	}
+
+	for _, obj := range existing {
+		err = r.Client.Delete(ctx, obj)
+		if err != nil {
+			log.Error(err, "could not remove unused object",
+				"kind", fmt.Sprintf("%T", obj),
+				"object", obj.GetName(),
+				"rulesNamespace", namespace,
+			)
+			return err
+		}
+	}
+
+	return nil
+}
+
+type openSLODocument struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Metadata   openSLOMetadata `json:"metadata"`
+	Spec       interface{}     `json:"spec"`
+}
+
+type openSLOMetadata struct {
+	Name        string            `json:"name"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// openSLOConfigMap renders the OpenSLO v1 documents of a SLO: one SLI and one
+// SLO for the availability objective and for each latency objective.
+func openSLOConfigMap(s InstanceSLO) (*corev1.ConfigMap, error) {
+	name := openSLOName(s.SLO.Name)
+	window := s.Class.Objectives.Window
+	if window == 0 {
+		window = defaultSLOWindow
+	}
+
+	type objective struct {
+		suffix  string
+		query   string
+		rawType string
+		target  float64
+	}
+
+	objectives := []objective{
+		{
+			suffix:  "availability",
+			query:   s.errorRatioQuery("5m"),
+			rawType: "failure",
+			target:  ratio(s.Class.Objectives.Availability),
+		},
+	}
+	for _, latency := range s.Class.Objectives.Latency {
+		objectives = append(objectives, objective{
+			suffix:  "latency-" + strings.ReplaceAll(latency.LE, ".", "-"),
+			query:   s.latencyRatioQuery("5m", latency.LE),
+			rawType: "success",
+			target:  ratio(latency.Target),
+		})
+	}
+
+	var buf bytes.Buffer
+	for _, o := range objectives {
+		documents := []openSLODocument{
+			{
+				APIVersion: "openslo/v1",
+				Kind:       "SLI",
+				Metadata: openSLOMetadata{
+					Name: name + "-" + o.suffix,
+				},
+				Spec: map[string]interface{}{
+					"ratioMetric": map[string]interface{}{
+						"counter": false,
+						"rawType": o.rawType,
+						"raw": map[string]interface{}{
+							"metricSource": map[string]interface{}{
+								"type": "Prometheus",
+								"spec": map[string]interface{}{
+									"query": o.query,
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				APIVersion: "openslo/v1",
+				Kind:       "SLO",
+				Metadata: openSLOMetadata{
+					Name:        name + "-" + o.suffix,
+					DisplayName: s.SLO.Name + " " + o.suffix,
+					Labels:      s.SLO.Labels,
+				},
+				Spec: map[string]interface{}{
+					"service":         s.SLO.Name,
+					"indicatorRef":    name + "-" + o.suffix,
+					"budgetingMethod": "Occurrences",
+					"timeWindow": []map[string]interface{}{
+						{"duration": window.String(), "isRolling": true},
+					},
+					"objectives": []map[string]interface{}{
+						{"displayName": o.suffix, "target": o.target},
+					},
+				},
+			},
+		}
+
+		for _, document := range documents {
+			data, err := yaml.Marshal(document)
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteString("---\n")
+			buf.Write(data)
+		}
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "openslo-" + s.SLO.Name,
+		},
+		Data: map[string]string{
+			openSLOConfigMapKey: buf.String(),
+		},
+	}, nil
+}
+
+// errorRatioQuery returns the error ratio of the SLO on the given window. SLOs
+// recording their own SLIs, whose recording rules only exist along with the
+// PrometheusRules output, are queried straight from the nginx series.
+func (s *InstanceSLO) errorRatioQuery(window string) string {
+	if s.SLO.ErrorRateRecord.Expr != "" {
+		return s.SLO.ErrorRateRecord.ComputeExpr(window, "")
+	}
+
+	return fmt.Sprintf(`slo:service_errors_total:ratio_rate_%s{service=%q}`, window, s.SLO.Name)
+}
+
+// latencyRatioQuery returns the ratio of requests faster than le on the given
+// window, see errorRatioQuery. The query can be subtracted from.
+func (s *InstanceSLO) latencyRatioQuery(window, le string) string {
+	if s.SLO.LatencyRecord.Expr != "" {
+		return "(" + s.SLO.LatencyRecord.ComputeExpr(window, le) + ")"
+	}
+
+	return fmt.Sprintf(`slo:service_latency:ratio_rate_%s{service=%q,le=%q}`, window, s.SLO.Name, le)
+}
+
+// openSLOName converts a SLO name into an OpenSLO name, which cannot have dots.
+func openSLOName(name string) string {
+	return strings.ReplaceAll(name, ".", "-")
+}
+
+// slothServiceLevel renders a Sloth PrometheusServiceLevel of a SLO, Sloth
+// alerts are disabled unless enableAlerts is set to avoid paging twice.
+func slothServiceLevel(s InstanceSLO, enableAlerts bool) *unstructured.Unstructured {
+	alerting := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":        name,
+			"labels":      toInterfaceMap(s.SLO.Labels),
+			"annotations": toInterfaceMap(s.SLO.Annotations),
+			"pageAlert":   map[string]interface{}{"disable": !enableAlerts},
+			"ticketAlert": map[string]interface{}{"disable": !enableAlerts},
+		}
+	}
+
+	slos := []interface{}{
+		map[string]interface{}{
+			"name":      "requests-availability",
+			"objective": s.Class.Objectives.Availability,
+			"sli": map[string]interface{}{
+				"raw": map[string]interface{}{
+					"errorRatioQuery": s.errorRatioQuery("{{.window}}"),
+				},
+			},
+			"alerting": alerting("RpaasSLOAvailability"),
+		},
+	}
+	for _, latency := range s.Class.Objectives.Latency {
+		slos = append(slos, map[string]interface{}{
+			"name":      "requests-latency-" + strings.ReplaceAll(latency.LE, ".", "-"),
+			"objective": latency.Target,
+			"sli": map[string]interface{}{
+				"raw": map[string]interface{}{
+					"errorRatioQuery": "1 - " + s.latencyRatioQuery("{{.window}}", latency.LE),
+				},
+			},
+			"alerting": alerting("RpaasSLOLatency"),
+		})
+	}
+
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"service": s.SLO.Name,
+				"labels":  toInterfaceMap(s.SLO.Labels),
+				"slos":    slos,
+			},
+		},
+	}
+	obj.SetGroupVersionKind(slothServiceLevelGVK)
+	obj.SetName(s.SLO.Name)
+
+	return obj
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	result := map[string]interface{}{}
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// ratio converts a percentage into a ratio without floating point noise.
+func ratio(percentage float64) float64 {
+	return math.Round(percentage*1e4) / 1e6
+}
@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func TestReconcileRpaasInstanceOpenSLOAndSlothOutputs(t *testing.T) {
+	ctx := context.TODO()
+	rpaasInstance1 := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Labels: map[string]string{
+				rpaasTeamOwnerAnnotation:    "my-team",
+				rpaasInstanceNameAnnotation: "instance1",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+			},
+			Annotations: map[string]string{
+				rpaasTagsAnnotation: "slo:critical",
+			},
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(rpaasInstance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client:      k8sClient,
+		Log:         ctrl.Log,
+		OutputModes: []string{OutputOpenSLO, OutputSloth},
+	}
+
+	_, err := reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "instance1",
+		},
+	})
+	require.NoError(t, err)
+
+	prometheusRules := monitoringv1.PrometheusRuleList{}
+	err = k8sClient.List(ctx, &prometheusRules)
+	require.NoError(t, err)
+	assert.Len(t, prometheusRules.Items, 0)
+
+	configMap := corev1.ConfigMap{}
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "openslo-tsuru.default.instance1",
+	}, &configMap)
+	require.NoError(t, err)
+	assert.Equal(t, "instance1", configMap.Labels[rpaasInstanceNameAnnotation])
+	assert.Len(t, configMap.OwnerReferences, 1)
+	assert.Contains(t, configMap.Data[openSLOConfigMapKey], "kind: SLI")
+	assert.Contains(t, configMap.Data[openSLOConfigMapKey], "name: tsuru-default-instance1-availability")
+	assert.Contains(t, configMap.Data[openSLOConfigMapKey], "name: tsuru-default-instance1-latency-0-200")
+	assert.Contains(t, configMap.Data[openSLOConfigMapKey], `query: slo:service_errors_total:ratio_rate_5m{service="tsuru.default.instance1"}`)
+	assert.Contains(t, configMap.Data[openSLOConfigMapKey], "target: 0.9999")
+
+	serviceLevel := &unstructured.Unstructured{}
+	serviceLevel.SetGroupVersionKind(slothServiceLevelGVK)
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "tsuru.default.instance1",
+	}, serviceLevel)
+	require.NoError(t, err)
+
+	data, err := yaml.Marshal(serviceLevel.Object["spec"])
+	require.NoError(t, err)
+	assert.Equal(t, `labels:
+  rpaas_instance: instance1
+  rpaas_service: rpaasv2
+  slo_class: critical
+  tsuru_team_owner: ""
+service: tsuru.default.instance1
+slos:
+- alerting:
+    annotations: {}
+    labels:
+      rpaas_instance: instance1
+      rpaas_service: rpaasv2
+      slo_class: critical
+      tsuru_team_owner: ""
+    name: RpaasSLOAvailability
+    pageAlert:
+      disable: false
+    ticketAlert:
+      disable: false
+  name: requests-availability
+  objective: 99.99
+  sli:
+    raw:
+      errorRatioQuery: slo:service_errors_total:ratio_rate_{{.window}}{service="tsuru.default.instance1"}
+- alerting:
+    annotations: {}
+    labels:
+      rpaas_instance: instance1
+      rpaas_service: rpaasv2
+      slo_class: critical
+      tsuru_team_owner: ""
+    name: RpaasSLOLatency
+    pageAlert:
+      disable: false
+    ticketAlert:
+      disable: false
+  name: requests-latency-0-200
+  objective: 99
+  sli:
+    raw:
+      errorRatioQuery: 1 - slo:service_latency:ratio_rate_{{.window}}{service="tsuru.default.instance1",le="0.200"}
+- alerting:
+    annotations: {}
+    labels:
+      rpaas_instance: instance1
+      rpaas_service: rpaasv2
+      slo_class: critical
+      tsuru_team_owner: ""
+    name: RpaasSLOLatency
+    pageAlert:
+      disable: false
+    ticketAlert:
+      disable: false
+  name: requests-latency-0-100
+  objective: 95
+  sli:
+    raw:
+      errorRatioQuery: 1 - slo:service_latency:ratio_rate_{{.window}}{service="tsuru.default.instance1",le="0.100"}
+`, string(data))
+
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "instance1"}, rpaasInstance1)
+	require.NoError(t, err)
+	rpaasInstance1.Annotations = map[string]string{}
+	err = k8sClient.Update(ctx, rpaasInstance1)
+	require.NoError(t, err)
+
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "instance1",
+		},
+	})
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "openslo-tsuru.default.instance1",
+	}, &configMap)
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "tsuru.default.instance1",
+	}, serviceLevel)
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+func TestReconcileRpaasInstanceOutputsWithoutPrometheusRules(t *testing.T) {
+	ctx := context.TODO()
+	rpaasInstance1 := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Labels: map[string]string{
+				rpaasInstanceNameAnnotation: "instance1",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+			},
+			Annotations: map[string]string{
+				definition.LocationSLOsAnnotation: `{"/api": "critical"}`,
+			},
+		},
+		Spec: v1alpha1.RpaasInstanceSpec{
+			Locations: []v1alpha1.Location{
+				{Path: "/api", Destination: "api"},
+			},
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(rpaasInstance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client:      k8sClient,
+		Log:         ctrl.Log,
+		OutputModes: []string{OutputOpenSLO, OutputSloth},
+	}
+
+	_, err := reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "instance1",
+		},
+	})
+	require.NoError(t, err)
+
+	// the location SLIs are only recorded by the PrometheusRules
+	configMap := corev1.ConfigMap{}
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "openslo-tsuru.default.instance1.api",
+	}, &configMap)
+	require.NoError(t, err)
+	assert.Contains(t, configMap.Data[openSLOConfigMapKey], `query: sum(rate(nginx_vts_filter_requests_total{namespace="default",rpaas_instance="instance1",filter="location",filter_name="/api",direction="5xx"}[5m]))`)
+	assert.NotContains(t, configMap.Data[openSLOConfigMapKey], "slo:service_")
+
+	serviceLevel := &unstructured.Unstructured{}
+	serviceLevel.SetGroupVersionKind(slothServiceLevelGVK)
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "tsuru.default.instance1.api",
+	}, serviceLevel)
+	require.NoError(t, err)
+
+	data, err := yaml.Marshal(serviceLevel.Object["spec"])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `errorRatioQuery: 1 - (sum(rate(nginx_vts_filter_request_duration_seconds_bucket{namespace="default",rpaas_instance="instance1",filter="location",filter_name="/api",le="0.200"}[{{.window}}]))`)
+	assert.NotContains(t, string(data), "slo:service_")
+}
+
+func TestReconcileRpaasInstanceDisabledOutputs(t *testing.T) {
+	ctx := context.TODO()
+	rpaasInstance1 := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Labels: map[string]string{
+				rpaasInstanceNameAnnotation: "instance1",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+			},
+			Annotations: map[string]string{
+				rpaasTagsAnnotation: "slo:critical",
+			},
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(rpaasInstance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client:      k8sClient,
+		Log:         ctrl.Log,
+		OutputModes: OutputModes,
+	}
+
+	reconcile := func() {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "instance1",
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	reconcile()
+
+	configMaps := corev1.ConfigMapList{}
+	err := k8sClient.List(ctx, &configMaps)
+	require.NoError(t, err)
+	assert.Len(t, configMaps.Items, 1)
+
+	serviceLevels := &unstructured.UnstructuredList{}
+	serviceLevels.SetGroupVersionKind(slothServiceLevelGVK.GroupVersion().WithKind(slothServiceLevelGVK.Kind + "List"))
+	err = k8sClient.List(ctx, serviceLevels)
+	require.NoError(t, err)
+	assert.Len(t, serviceLevels.Items, 1)
+
+	prometheusRules := monitoringv1.PrometheusRuleList{}
+	err = k8sClient.List(ctx, &prometheusRules)
+	require.NoError(t, err)
+	assert.Len(t, prometheusRules.Items, 1)
+
+	reconciler.OutputModes = []string{OutputPrometheusRules}
+	reconcile()
+
+	err = k8sClient.List(ctx, &configMaps)
+	require.NoError(t, err)
+	assert.Len(t, configMaps.Items, 0)
+
+	err = k8sClient.List(ctx, serviceLevels)
+	require.NoError(t, err)
+	assert.Len(t, serviceLevels.Items, 0)
+
+	err = k8sClient.List(ctx, &prometheusRules)
+	require.NoError(t, err)
+	assert.Len(t, prometheusRules.Items, 1)
+
+	reconciler.OutputModes = []string{OutputSloth}
+	reconcile()
+
+	err = k8sClient.List(ctx, &prometheusRules)
+	require.NoError(t, err)
+	assert.Len(t, prometheusRules.Items, 0)
+
+	err = k8sClient.List(ctx, serviceLevels)
+	require.NoError(t, err)
+	assert.Len(t, serviceLevels.Items, 1)
+}
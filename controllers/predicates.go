@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// sloAnnotationsPrefix is the prefix of the annotations declaring SLOs, eg:
+// rpaas.extensions.tsuru.io/slo-locations.
+const sloAnnotationsPrefix = "rpaas.extensions.tsuru.io/slo-"
+
+// relevantChangesPredicate filters out the updates of RpaasInstances not
+// changing any field used to generate SLOs, such as status updates and most
+// of the spec, counting them on the filtered events metric.
+func relevantChangesPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldInstance, ok := e.ObjectOld.(*v1alpha1.RpaasInstance)
+			if !ok {
+				return true
+			}
+			newInstance, ok := e.ObjectNew.(*v1alpha1.RpaasInstance)
+			if !ok {
+				return true
+			}
+
+			if relevantChanges(oldInstance, newInstance) {
+				return true
+			}
+
+			filteredEvents.WithLabelValues("update").Inc()
+			return false
+		},
+	}
+}
+
+// relevantChanges returns whether any field used to generate the SLOs of an
+// instance changed. Labels are compared as a whole, since they may be used by
+// the instance selector and by the alert templates.
+func relevantChanges(oldInstance, newInstance *v1alpha1.RpaasInstance) bool {
+	if oldInstance.Namespace != newInstance.Namespace {
+		return true
+	}
+
+	if (oldInstance.DeletionTimestamp == nil) != (newInstance.DeletionTimestamp == nil) {
+		return true
+	}
+
+	if !reflect.DeepEqual(oldInstance.Labels, newInstance.Labels) {
+		return true
+	}
+
+	if !reflect.DeepEqual(sloAnnotations(oldInstance), sloAnnotations(newInstance)) {
+		return true
+	}
+
+	return !reflect.DeepEqual(oldInstance.Spec.Locations, newInstance.Spec.Locations)
+}
+
+func sloAnnotations(rpaasInstance *v1alpha1.RpaasInstance) map[string]string {
+	result := map[string]string{}
+	for key, value := range rpaasInstance.Annotations {
+		if key == rpaasTagsAnnotation || key == rpaasTeamOwnerAnnotation || strings.HasPrefix(key, sloAnnotationsPrefix) {
+			result[key] = value
+		}
+	}
+	return result
+}
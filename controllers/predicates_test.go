@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestRelevantChangesPredicate(t *testing.T) {
+	base := func() *v1alpha1.RpaasInstance {
+		return &v1alpha1.RpaasInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "my-instance",
+				Namespace: "rpaasv2-fe-pool1",
+				Labels: map[string]string{
+					rpaasInstanceNameAnnotation: "my-instance",
+				},
+				Annotations: map[string]string{
+					rpaasTagsAnnotation:      "slo:critical",
+					rpaasTeamOwnerAnnotation: "team-a",
+				},
+			},
+			Spec: v1alpha1.RpaasInstanceSpec{
+				Locations: []v1alpha1.Location{{Path: "/api"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		change   func(*v1alpha1.RpaasInstance)
+		expected bool
+	}{
+		{
+			name:     "status update",
+			change:   func(i *v1alpha1.RpaasInstance) { i.Status.ObservedGeneration = 2 },
+			expected: false,
+		},
+		{
+			name:     "replicas update",
+			change:   func(i *v1alpha1.RpaasInstance) { replicas := int32(3); i.Spec.Replicas = &replicas },
+			expected: false,
+		},
+		{
+			name: "unrelated annotation",
+			change: func(i *v1alpha1.RpaasInstance) {
+				i.Annotations["rpaas.extensions.tsuru.io/recommended-slo-class"] = "high"
+			},
+			expected: false,
+		},
+		{
+			name:     "tags",
+			change:   func(i *v1alpha1.RpaasInstance) { i.Annotations[rpaasTagsAnnotation] = "slo:high" },
+			expected: true,
+		},
+		{
+			name:     "team owner",
+			change:   func(i *v1alpha1.RpaasInstance) { i.Annotations[rpaasTeamOwnerAnnotation] = "team-b" },
+			expected: true,
+		},
+		{
+			name:     "slo annotation",
+			change:   func(i *v1alpha1.RpaasInstance) { i.Annotations[definition.LocationSLOsAnnotation] = `{"/api": "high"}` },
+			expected: true,
+		},
+		{
+			name:     "labels",
+			change:   func(i *v1alpha1.RpaasInstance) { i.Labels[rpaasServiceNameAnnotation] = "rpaasv2" },
+			expected: true,
+		},
+		{
+			name: "locations",
+			change: func(i *v1alpha1.RpaasInstance) {
+				i.Spec.Locations = append(i.Spec.Locations, v1alpha1.Location{Path: "/"})
+			},
+			expected: true,
+		},
+		{
+			name: "deletion",
+			change: func(i *v1alpha1.RpaasInstance) {
+				now := metav1.Now()
+				i.DeletionTimestamp = &now
+			},
+			expected: true,
+		},
+	}
+
+	p := relevantChangesPredicate()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered := testutil.ToFloat64(filteredEvents.WithLabelValues("update"))
+
+			newInstance := base()
+			tt.change(newInstance)
+			assert.Equal(t, tt.expected, p.Update(event.UpdateEvent{ObjectOld: base(), ObjectNew: newInstance}))
+
+			expectedFiltered := filtered
+			if !tt.expected {
+				expectedFiltered++
+			}
+			assert.Equal(t, expectedFiltered, testutil.ToFloat64(filteredEvents.WithLabelValues("update")))
+		})
+	}
+
+	assert.True(t, p.Create(event.CreateEvent{Object: base()}))
+	assert.True(t, p.Delete(event.DeleteEvent{Object: base()}))
+}
@@ -6,19 +6,24 @@ import (
 	"strings"
 	"text/template"
 
-	sloKubernetes "github.com/globocom/slo-generator/kubernetes"
-	"github.com/globocom/slo-generator/slo"
 	"github.com/go-logr/logr"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	"github.com/tsuru/rpaas-operator/api/v1alpha1"
 	"github.com/tsuru/rpaas-slo-controller/definition"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
@@ -27,6 +32,11 @@ const (
 	rpaasTeamOwnerAnnotation    = "rpaas.extensions.tsuru.io/team-owner"
 	rpaasInstanceNameAnnotation = "rpaas.extensions.tsuru.io/instance-name"
 	rpaasServiceNameAnnotation  = "rpaas.extensions.tsuru.io/service-name"
+
+	// instanceNamespaceLabel tells apart the objects of instances sharing
+	// the name and the service, whose namespaces map to the same rules
+	// namespace, eg: rpaasv2-fe-pool and rpaasv2-be-pool.
+	instanceNamespaceLabel = "slo.tsuru.io/instance-namespace"
 )
 
 var _ reconcile.Reconciler = &RpaasInstanceReconciler{}
@@ -36,11 +46,79 @@ type RpaasInstanceReconciler struct {
 	AlertLinkTemplate    *template.Template
 	AlertMessageTemplate *template.Template
 
+	// OutputModes are the enabled outputs, see OutputModes. Only
+	// PrometheusRules are generated when empty.
+	OutputModes []string
+
+	// MigrateDeprecatedClasses generates the SLOs using deprecated classes
+	// with their replacements instead.
+	MigrateDeprecatedClasses bool
+
+	// AlertInhibition generates AlertmanagerConfigs inhibiting the alerts of
+	// instances while the alerts of their dependencies are firing.
+	AlertInhibition bool
+
+	// InstanceSelector restricts the reconciled RpaasInstances, every
+	// instance is reconciled when nil.
+	InstanceSelector labels.Selector
+
+	// RuleLabels are templates of labels added to the PrometheusRules, so
+	// they are picked up by the ruleSelector of the right Prometheus, see
+	// RuleLabelsData.
+	RuleLabels map[string]*template.Template
+
+	// WarnUnselectedRules emits a warning event on instances whose
+	// PrometheusRules are not selected by any Prometheus object.
+	WarnUnselectedRules bool
+
+	// RulesBackend stores the rules of the SLOs, PrometheusRules are created
+	// when nil.
+	RulesBackend RulesBackend
+
+	// RulesShardMaxSize enables packing the rule groups of the instances into
+	// shared PrometheusRules of up to this size in bytes, see
+	// reconcileRulesShards. Each instance has its own PrometheusRules when
+	// zero. Only used by the default RulesBackend.
+	RulesShardMaxSize int
+
+	// TracerProvider traces the reconciliations, the global provider is
+	// used when nil.
+	TracerProvider trace.TracerProvider
+
+	// APIReader reads the objects that may live out of the namespaces cached
+	// by Client, such as the backends of frontend instances and the
+	// Prometheus objects, straight from the API server. Client is used when
+	// nil.
+	APIReader client.Reader
+
 	client.Client
-	Log logr.Logger
+	Log      logr.Logger
+	Recorder record.EventRecorder
+
+	migrations classMigrations
 }
 
-func (r *RpaasInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *RpaasInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	reconcileID := string(uuid.NewUUID())
+	ctx = logr.NewContext(ctx, r.Log.WithValues(
+		"instance", req.Name,
+		"namespace", req.Namespace,
+		"reconcileID", reconcileID,
+	))
+
+	ctx, span := r.startSpan(ctx, "Reconcile",
+		attribute.String("instance", req.Name),
+		attribute.String("namespace", req.Namespace),
+		attribute.String("reconcileID", reconcileID),
+	)
+	defer func() { endSpan(span, err) }()
+
+	return r.reconcile(ctx, req)
+}
+
+func (r *RpaasInstanceReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.logger(ctx)
+
 	rpaasInstance := &v1alpha1.RpaasInstance{}
 	err := r.Client.Get(ctx, client.ObjectKey{
 		Namespace: req.Namespace,
@@ -48,84 +126,166 @@ func (r *RpaasInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	}, rpaasInstance)
 	if err != nil {
 		if k8sErrors.IsNotFound(err) {
+			// instances without outputsFinalizer are gone along with their
+			// labels, the instance name label is assumed to hold their name
+			rpaasInstance.Namespace, rpaasInstance.Name = req.Namespace, req.Name
+			rpaasInstance.Labels = map[string]string{rpaasInstanceNameAnnotation: req.Name}
+			r.recordClassMigrations(rpaasInstance, nil)
 			err = r.reconcileRemovePrometheusRules(ctx, rpaasInstance)
 			return ctrl.Result{}, err
 		}
 		return ctrl.Result{}, err
 	}
 
-	sloClass, _ := definition.SLOClass(rpaasInstance)
-	if sloClass == nil {
-		r.Log.Info("could not find a SLO classs",
-			"name", req.Name,
-			"namespace", req.Namespace,
-		)
+	log = log.WithValues("class", definition.SLOClassName(rpaasInstance))
+	ctx = logr.NewContext(ctx, log)
+
+	if rpaasInstance.DeletionTimestamp != nil {
+		return ctrl.Result{}, r.reconcileDeletedInstance(ctx, rpaasInstance)
+	}
+
+	err = r.reconcilePreviousRulesNamespace(ctx, rpaasInstance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !selected(r.InstanceSelector, rpaasInstance) {
+		log.Info("RpaasInstance out of the instance selector")
+		r.recordClassMigrations(rpaasInstance, nil)
+		err = r.reconcileRemovePrometheusRules(ctx, rpaasInstance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.recordRulesNamespace(ctx, rpaasInstance, "")
+	}
+
+	slos, err := r.instanceSLOs(ctx, rpaasInstance)
+	if err != nil {
+		log.Error(err, "could not generate some of the SLOs")
+	}
+
+	for _, s := range slos {
+		log.V(1).Info("generated SLO", "slo", s.SLO.Name, "class", s.Class.Name)
+	}
+	r.recordClassMigrations(rpaasInstance, slos)
+
+	if len(slos) == 0 {
+		log.Info("could not find a SLO classs")
 		err = r.reconcileRemovePrometheusRules(ctx, rpaasInstance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.recordRulesNamespace(ctx, rpaasInstance, "")
+	}
+
+	err = r.reconcileOutputs(ctx, rpaasInstance, slos)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// scheduled SLOs must be generated again when the time zone offset changes
+	result := ctrl.Result{RequeueAfter: scheduleRequeueAfter(slos)}
+
+	// rules are removed when the PrometheusRules output is disabled
+	var prometheusRules []monitoringv1.PrometheusRule
+	if r.outputEnabled(OutputPrometheusRules) {
+		prometheusRules = r.instancePrometheusRules(rpaasInstance, slos)
+	}
+
+	spanCtx, span := r.startSpan(ctx, "ApplyRules", attribute.Int("rules", len(prometheusRules)))
+	err = r.rulesBackend().ApplyRules(spanCtx, rpaasInstance, prometheusRules)
+	endSpan(span, err)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = r.removeStaleRules(ctx, rpaasInstance)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	return result, r.recordRulesNamespace(ctx, rpaasInstance, rulesNamespace(ctx, rpaasInstance))
+}
+
+// instanceSLOs generates the SLOs of the instance, with the alert annotations
+// rendered, returning the error of the SLOs that could not be generated.
+func (r *RpaasInstanceReconciler) instanceSLOs(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) ([]InstanceSLO, error) {
+	log := r.logger(ctx)
+
 	sloAnnotations := map[string]string{}
+	_, span := r.startSpan(ctx, "RenderAlertTemplates")
 	if r.AlertLinkTemplate != nil {
 		var buf bytes.Buffer
-		err = r.AlertLinkTemplate.Execute(&buf, rpaasInstance)
+		err := r.AlertLinkTemplate.Execute(&buf, rpaasInstance)
 		if err != nil {
-			r.Log.Error(err, "could not generate alert link",
-				"name", req.Name,
-				"namespace", req.Namespace,
-			)
+			log.Error(err, "could not generate alert link")
 		}
 		sloAnnotations["link"] = buf.String()
 	}
 
 	if r.AlertMessageTemplate != nil {
 		var buf bytes.Buffer
-		err = r.AlertMessageTemplate.Execute(&buf, rpaasInstance)
+		err := r.AlertMessageTemplate.Execute(&buf, rpaasInstance)
 		if err != nil {
-			r.Log.Error(err, "could not generate alert message",
-				"name", req.Name,
-				"namespace", req.Namespace,
-			)
+			log.Error(err, "could not generate alert message")
 		}
 		sloAnnotations["message"] = buf.String()
 	}
 
-	rulesNamespace := implicitNamespace(rpaasInstance.Namespace)
-	instancePool := implicitPool(rpaasInstance.Namespace)
+	span.End()
 
-	prometheusRulesLabels := map[string]string{
-		"tsuru_team_owner": rpaasInstance.ObjectMeta.Annotations[rpaasTeamOwnerAnnotation],
-		"rpaas_instance":   rpaasInstance.Labels[rpaasInstanceNameAnnotation],
-		"rpaas_service":    rpaasInstance.Labels[rpaasServiceNameAnnotation],
-		"slo_class":        sloClass.Name,
+	_, span = r.startSpan(ctx, "GenerateSLOs")
+	slos, err := InstanceSLOs(rpaasInstance, sloAnnotations)
+	endSpan(span, err)
+
+	if r.MigrateDeprecatedClasses {
+		slos = migrateDeprecatedClasses(slos)
 	}
 
-	if instancePool != "" {
-		prometheusRulesLabels["tsuru_pool"] = instancePool
+	return slos, err
+}
+
+func (r *RpaasInstanceReconciler) instancePrometheusRules(rpaasInstance *v1alpha1.RpaasInstance, slos []InstanceSLO) []monitoringv1.PrometheusRule {
+	var prometheusRules []monitoringv1.PrometheusRule
+	for _, s := range slos {
+		for _, prometheusRule := range s.PrometheusRules() {
+			prometheusRule.Labels = r.ruleLabels(rpaasInstance, s.Class.Name)
+			prometheusRules = append(prometheusRules, prometheusRule)
+		}
 	}
+	return prometheusRules
+}
 
-	prometheusRules := sloKubernetes.GenerateManifests(sloKubernetes.Opts{
-		SLO: slo.SLO{
-			Name:        "tsuru." + req.Namespace + "." + req.Name,
-			Class:       sloClass.Name,
-			Labels:      prometheusRulesLabels,
-			Annotations: sloAnnotations,
-			LatencyRecord: slo.ExprBlock{
-				AlertMethod: "multi-window",
-			},
-			ErrorRateRecord: slo.ExprBlock{
-				AlertMethod: "multi-window",
-			},
-		},
-		Class: sloClass,
-	})
+// DesiredPrometheusRules returns the PrometheusRules the reconciler would
+// generate for the instance, along with the error of the SLOs that could not
+// be generated.
+func (r *RpaasInstanceReconciler) DesiredPrometheusRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) ([]monitoringv1.PrometheusRule, error) {
+	slos, err := r.instanceSLOs(ctx, rpaasInstance)
+	return r.instancePrometheusRules(rpaasInstance, slos), err
+}
+
+// reconcilePrometheusRules creates or updates the PrometheusRules of the
+// instance, or the rule groups on shards, removing the ones not given
+// anymore.
+func (r *RpaasInstanceReconciler) reconcilePrometheusRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, prometheusRules []monitoringv1.PrometheusRule) error {
+	log := r.logger(ctx)
+
+	rulesNamespace := rulesNamespace(ctx, rpaasInstance)
+
+	if r.RulesShardMaxSize > 0 {
+		err := r.reconcileRulesShards(ctx, rpaasInstance, prometheusRules)
+		if err != nil {
+			return err
+		}
+
+		// rules generated before enabling shards
+		return r.deletePrometheusRules(ctx, rpaasInstance)
+	}
 
 	existingPrometheusRules, err := r.existingPrometheusRules(ctx, rpaasInstance)
 	if err != nil {
-		r.Log.Error(err, "could not get PrometheusRules",
-			"name", req.Name,
-			"namespace", req.Namespace,
-		)
-		return ctrl.Result{}, err
+		log.Error(err, "could not get PrometheusRules")
+		return err
 	}
 
 	existingPrometheusRulesSet := map[string]*monitoringv1.PrometheusRule{}
@@ -136,112 +296,194 @@ func (r *RpaasInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	for _, prometheusRule := range prometheusRules {
 		prometheusRule.Namespace = rulesNamespace
 
-		if prometheusRule.Labels == nil {
-			prometheusRule.Labels = map[string]string{}
-		}
 		if prometheusRule.Annotations == nil {
 			prometheusRule.Annotations = map[string]string{}
 		}
-		if instancePool != "" {
-			prometheusRule.Labels[tsuruPoolLabel] = instancePool
-		}
-		prometheusRule.Labels[rpaasTeamOwnerAnnotation] = rpaasInstance.Labels[rpaasTeamOwnerAnnotation]
-		prometheusRule.Labels[rpaasInstanceNameAnnotation] = rpaasInstance.Labels[rpaasInstanceNameAnnotation]
-		prometheusRule.Labels[rpaasServiceNameAnnotation] = rpaasInstance.Labels[rpaasServiceNameAnnotation]
-
-		if rulesNamespace == rpaasInstance.Namespace {
-			prometheusRule.OwnerReferences = append(prometheusRule.OwnerReferences, *metav1.NewControllerRef(rpaasInstance, schema.GroupVersionKind{
-				Group:   v1alpha1.GroupVersion.Group,
-				Version: v1alpha1.GroupVersion.Version,
-				Kind:    "RpaasInstance",
-			}))
-		}
+		prometheusRule.Labels = ownedObjectLabels(rpaasInstance, prometheusRule.Labels)
+		prometheusRule.OwnerReferences = ownerReferences(rpaasInstance, rulesNamespace)
 
 		if existingPrometheusRulesSet[prometheusRule.Name] == nil {
-			err := r.Client.Create(ctx, &prometheusRule)
+			spanCtx, span := r.startRuleSpan(ctx, "CreatePrometheusRule", &prometheusRule)
+			err := r.Client.Create(spanCtx, &prometheusRule)
+			endSpan(span, err)
 			if err != nil {
-				r.Log.Error(err, "could not create PrometheusRule",
-					"name", prometheusRule.Name,
-					"namespace", prometheusRule.Namespace,
+				log.Error(err, "could not create PrometheusRule",
+					"rule", prometheusRule.Name,
+					"rulesNamespace", prometheusRule.Namespace,
 				)
-				return ctrl.Result{}, err
+				return err
 			}
 
-			r.Log.Info("created PrometheusRule",
-				"name", prometheusRule.Name,
-				"namespace", prometheusRule.Namespace)
+			log.Info("created PrometheusRule",
+				"rule", prometheusRule.Name,
+				"rulesNamespace", prometheusRule.Namespace)
+			r.warnUnselectedRules(ctx, rpaasInstance, &prometheusRule)
 		} else {
 			prometheusRule.ResourceVersion = existingPrometheusRulesSet[prometheusRule.Name].ResourceVersion
 			delete(existingPrometheusRulesSet, prometheusRule.Name)
-			err := r.Client.Update(ctx, &prometheusRule)
+			spanCtx, span := r.startRuleSpan(ctx, "UpdatePrometheusRule", &prometheusRule)
+			err := r.Client.Update(spanCtx, &prometheusRule)
+			endSpan(span, err)
 			if err != nil {
-				r.Log.Error(err, "could not update PrometheusRule",
-					"name", prometheusRule.Name,
-					"namespace", prometheusRule.Namespace,
+				log.Error(err, "could not update PrometheusRule",
+					"rule", prometheusRule.Name,
+					"rulesNamespace", prometheusRule.Namespace,
 				)
-				return ctrl.Result{}, err
+				return err
 			}
 
-			r.Log.Info("updated PrometheusRule",
-				"name", prometheusRule.Name,
-				"namespace", prometheusRule.Namespace)
+			log.Info("updated PrometheusRule",
+				"rule", prometheusRule.Name,
+				"rulesNamespace", prometheusRule.Namespace)
+			r.warnUnselectedRules(ctx, rpaasInstance, &prometheusRule)
 		}
 	}
 
 	for _, existingPrometheusRule := range existingPrometheusRulesSet {
-		err = r.Client.Delete(ctx, existingPrometheusRule)
+		spanCtx, span := r.startRuleSpan(ctx, "DeletePrometheusRule", existingPrometheusRule)
+		err = r.Client.Delete(spanCtx, existingPrometheusRule)
+		endSpan(span, err)
 		if err != nil {
-			r.Log.Error(err, "could not remove unused PrometheusRule",
-				"name", existingPrometheusRule.Name,
-				"namespace", existingPrometheusRule.Namespace,
+			log.Error(err, "could not remove unused PrometheusRule",
+				"rule", existingPrometheusRule.Name,
+				"rulesNamespace", existingPrometheusRule.Namespace,
 			)
-			return ctrl.Result{}, err
+			return err
 		}
 	}
 
-	return ctrl.Result{}, nil
+	// rules generated before disabling shards
+	return r.reconcileRulesShards(ctx, rpaasInstance, nil)
 }
 
-func (r *RpaasInstanceReconciler) reconcileRemovePrometheusRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) error {
-	existingPrometheusRules, err := r.existingPrometheusRules(ctx, rpaasInstance)
+// ownedObjectLabels returns the labels used to find out the objects generated
+// for a RpaasInstance, merged into the given labels.
+func ownedObjectLabels(rpaasInstance *v1alpha1.RpaasInstance, base map[string]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range base {
+		result[k] = v
+	}
+
+	if instancePool := implicitPool(rpaasInstance.Namespace); instancePool != "" {
+		result[tsuruPoolLabel] = instancePool
+	}
+	result[rpaasTeamOwnerAnnotation] = rpaasInstance.Labels[rpaasTeamOwnerAnnotation]
+	result[rpaasInstanceNameAnnotation] = rpaasInstance.Labels[rpaasInstanceNameAnnotation]
+	result[rpaasServiceNameAnnotation] = rpaasInstance.Labels[rpaasServiceNameAnnotation]
+	result[instanceNamespaceLabel] = rpaasInstance.Namespace
+
+	return result
+}
+
+// ownerLabels selects the objects generated for a RpaasInstance, which are
+// told apart from the ones of same-named instances by OwnedBy. The service
+// label is not selected when unknown, as for removed instances.
+func ownerLabels(rpaasInstance *v1alpha1.RpaasInstance) client.MatchingLabels {
+	result := client.MatchingLabels{
+		rpaasInstanceNameAnnotation: rpaasInstance.Labels[rpaasInstanceNameAnnotation],
+	}
+	if service, found := rpaasInstance.Labels[rpaasServiceNameAnnotation]; found {
+		result[rpaasServiceNameAnnotation] = service
+	}
+
+	return result
+}
+
+// OwnedBy tells whether an object, matching the name and service labels of
+// the instance, was generated for it. Objects generated before
+// instanceNamespaceLabel existed are owned when their name holds the SLO name
+// of the instance, which includes its namespace; they are labeled once
+// updated.
+func OwnedBy(rpaasInstance *v1alpha1.RpaasInstance, obj metav1.Object) bool {
+	if namespace, found := obj.GetLabels()[instanceNamespaceLabel]; found {
+		return namespace == rpaasInstance.Namespace
+	}
+
+	return strings.Contains(obj.GetName(), InstanceSLOName(rpaasInstance))
+}
+
+// ownerReferences returns the owner references of objects generated for a
+// RpaasInstance, cross namespace objects cannot be owned by the instance.
+func ownerReferences(rpaasInstance *v1alpha1.RpaasInstance, namespace string) []metav1.OwnerReference {
+	if namespace != rpaasInstance.Namespace {
+		return nil
+	}
+
+	return []metav1.OwnerReference{
+		*metav1.NewControllerRef(rpaasInstance, schema.GroupVersionKind{
+			Group:   v1alpha1.GroupVersion.Group,
+			Version: v1alpha1.GroupVersion.Version,
+			Kind:    "RpaasInstance",
+		}),
+	}
+}
+
+func (r *RpaasInstanceReconciler) reconcileRemovePrometheusRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) (err error) {
+	r.logger(ctx).V(1).Info("removing SLO outputs")
+
+	ctx, span := r.startSpan(ctx, "RemoveSLOOutputs")
+	defer func() { endSpan(span, err) }()
+
+	err = r.reconcileOutputs(ctx, rpaasInstance, nil)
 	if err != nil {
-		r.Log.Error(err, "could not get PrometheusRules",
-			"name", rpaasInstance.Name,
-			"namespace", rpaasInstance.Namespace,
-		)
 		return err
 	}
 
-	for _, rule := range existingPrometheusRules {
-		err = r.Client.Delete(ctx, rule)
+	err = r.rulesBackend().ApplyRules(ctx, rpaasInstance, nil)
+	if err != nil {
+		return err
+	}
 
-		r.Log.Error(err, "could not remove unused PrometheusRule",
-			"name", rule.Name,
-			"namespace", rule.Namespace,
-		)
+	return r.removeStaleRules(ctx, rpaasInstance)
+}
+
+// deletePrometheusRules removes the PrometheusRules of the instance, rule
+// groups on shards are kept.
+func (r *RpaasInstanceReconciler) deletePrometheusRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) error {
+	log := r.logger(ctx)
 
+	existingPrometheusRules, err := r.existingPrometheusRules(ctx, rpaasInstance)
+	if err != nil {
+		log.Error(err, "could not get PrometheusRules")
 		return err
 	}
 
+	for _, rule := range existingPrometheusRules {
+		spanCtx, span := r.startRuleSpan(ctx, "DeletePrometheusRule", rule)
+		err = r.Client.Delete(spanCtx, rule)
+		endSpan(span, err)
+		if err != nil {
+			log.Error(err, "could not remove unused PrometheusRule",
+				"rule", rule.Name,
+				"rulesNamespace", rule.Namespace,
+			)
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (r *RpaasInstanceReconciler) existingPrometheusRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) ([]*monitoringv1.PrometheusRule, error) {
-	rulesNamespace := implicitNamespace(rpaasInstance.Namespace)
+	rulesNamespace := rulesNamespace(ctx, rpaasInstance)
+
+	ctx, span := r.startSpan(ctx, "ListPrometheusRules", attribute.String("rulesNamespace", rulesNamespace))
 	list := monitoringv1.PrometheusRuleList{}
-	err := r.Client.List(ctx, &list, &client.ListOptions{
-		Namespace: rulesNamespace,
-		LabelSelector: labels.SelectorFromSet(labels.Set{
-			rpaasInstanceNameAnnotation: rpaasInstance.Labels[rpaasInstanceNameAnnotation],
-			rpaasServiceNameAnnotation:  rpaasInstance.Labels[rpaasServiceNameAnnotation],
-		}),
-	})
+	err := r.Client.List(ctx, &list, client.InNamespace(rulesNamespace), ownerLabels(rpaasInstance))
+	endSpan(span, err)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return list.Items, nil
+	var owned []*monitoringv1.PrometheusRule
+	for _, rule := range list.Items {
+		if OwnedBy(rpaasInstance, rule) {
+			owned = append(owned, rule)
+		}
+	}
+
+	return owned, nil
 }
 
 func implicitNamespace(ns string) string {
@@ -262,7 +504,13 @@ func implicitPool(ns string) string {
 }
 
 func (r *RpaasInstanceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.RpaasInstance{}).
-		Complete(r)
+	instancePredicate := builder.WithPredicates(instanceSelectorPredicate(r.InstanceSelector), relevantChangesPredicate())
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.RpaasInstance{}, instancePredicate)
+
+	if r.AlertInhibition {
+		b = b.Watches(&source.Kind{Type: &v1alpha1.RpaasInstance{}}, handler.EnqueueRequestsFromMapFunc(frontendsOf), instancePredicate)
+	}
+
+	return b.Complete(r)
 }
@@ -6,14 +6,17 @@ import (
 	"text/template"
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/definition"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -77,6 +80,7 @@ func TestReconcileRpaasInstanceSLOCritical(t *testing.T) {
 		rpaasTeamOwnerAnnotation:    "my-team",
 		rpaasInstanceNameAnnotation: "instance1",
 		rpaasServiceNameAnnotation:  "rpaasv2",
+		instanceNamespaceLabel:      "default",
 	}, prometheusRule.Labels)
 
 	_true := true
@@ -143,11 +147,20 @@ func TestReconcileRpaasInstancePoolNamespaced(t *testing.T) {
 		rpaasInstanceNameAnnotation: "instance1",
 		rpaasServiceNameAnnotation:  "rpaasv2",
 		tsuruPoolLabel:              "mypool",
+		instanceNamespaceLabel:      "rpaasv2-fe-mypool",
 	}, prometheusRule.Labels)
 
 	assert.Len(t, prometheusRule.OwnerReferences, 0)
 	require.Len(t, prometheusRule.Spec.Groups, 1)
 	assert.Len(t, prometheusRule.Spec.Groups[0].Rules, 4)
+
+	// without owner references, rules are removed along with the instance
+	require.NoError(t, k8sClient.Delete(ctx, rpaasInstance1))
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(rpaasInstance1)})
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(&prometheusRule), &monitoringv1.PrometheusRule{})
+	assert.True(t, k8sErrors.IsNotFound(err))
 }
 
 func TestReconcileRpaasInstanceUpdate(t *testing.T) {
@@ -217,6 +230,7 @@ func TestReconcileRpaasInstanceUpdate(t *testing.T) {
 		rpaasTeamOwnerAnnotation:    "my-team",
 		rpaasInstanceNameAnnotation: "instance1",
 		rpaasServiceNameAnnotation:  "rpaasv2",
+		instanceNamespaceLabel:      "default",
 	}, prometheusRule.Labels)
 
 	_true := true
@@ -294,6 +308,81 @@ func TestReconcileRpaasInstanceRemoveSLO(t *testing.T) {
 	assert.True(t, k8sErrors.IsNotFound(err))
 }
 
+func TestReconcileRpaasInstanceSameNameAcrossServices(t *testing.T) {
+	ctx := context.TODO()
+	frontend := newShardedInstance("instance1")
+	backend := newShardedInstance("instance1")
+	backend.Namespace = "rpaasv2-be-pool1"
+
+	legacyLabels := ownedObjectLabels(frontend, nil)
+	delete(legacyLabels, instanceNamespaceLabel)
+	legacyFrontendRule := &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "tsuru-pool1",
+			Name:      "slos-alerts-tsuru.rpaasv2-fe-pool1.instance1",
+			Labels:    legacyLabels,
+		},
+	}
+	legacyBackendRule := &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "tsuru-pool1",
+			Name:      "slos-alerts-tsuru.rpaasv2-be-pool1.instance1",
+			Labels:    legacyLabels,
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(frontend, backend, legacyFrontendRule, legacyBackendRule).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log,
+	}
+	frontendReq := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(frontend)}
+	backendReq := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(backend)}
+
+	_, err := reconciler.Reconcile(ctx, frontendReq)
+	require.NoError(t, err)
+
+	// the legacy rule of the frontend is adopted, the backend one is untouched
+	prometheusRule := monitoringv1.PrometheusRule{}
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyFrontendRule), &prometheusRule)
+	require.NoError(t, err)
+	assert.Equal(t, "rpaasv2-fe-pool1", prometheusRule.Labels[instanceNamespaceLabel])
+	assert.NotEmpty(t, prometheusRule.Spec.Groups)
+
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyBackendRule), &prometheusRule)
+	require.NoError(t, err)
+	assert.NotContains(t, prometheusRule.Labels, instanceNamespaceLabel)
+	assert.Empty(t, prometheusRule.Spec.Groups)
+
+	_, err = reconciler.Reconcile(ctx, backendReq)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyBackendRule), &prometheusRule)
+	require.NoError(t, err)
+	assert.Equal(t, "rpaasv2-be-pool1", prometheusRule.Labels[instanceNamespaceLabel])
+
+	// removing the SLO of the frontend keeps the backend rules
+	instance := v1alpha1.RpaasInstance{}
+	require.NoError(t, k8sClient.Get(ctx, frontendReq.NamespacedName, &instance))
+	instance.Annotations[rpaasTagsAnnotation] = ""
+	require.NoError(t, k8sClient.Update(ctx, &instance))
+	_, err = reconciler.Reconcile(ctx, frontendReq)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyFrontendRule), &prometheusRule)
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	rules := monitoringv1.PrometheusRuleList{}
+	require.NoError(t, k8sClient.List(ctx, &rules, client.InNamespace("tsuru-pool1")))
+	var names []string
+	for _, rule := range rules.Items {
+		names = append(names, rule.Name)
+	}
+	assert.Equal(t, []string{"slos-alerts-tsuru.rpaasv2-be-pool1.instance1"}, names)
+}
+
 func TestReconcileRpaasInstanceInvalidSLO(t *testing.T) {
 	ctx := context.TODO()
 	rpaasInstance1 := &v1alpha1.RpaasInstance{
@@ -347,3 +436,350 @@ func TestReconcileRpaasInstanceInvalidSLO(t *testing.T) {
 	require.Error(t, err)
 	assert.True(t, k8sErrors.IsNotFound(err))
 }
+
+func TestReconcileRpaasInstanceLocationSLOs(t *testing.T) {
+	ctx := context.TODO()
+	rpaasInstance1 := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Labels: map[string]string{
+				rpaasTeamOwnerAnnotation:    "my-team",
+				rpaasInstanceNameAnnotation: "instance1",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+			},
+			Annotations: map[string]string{
+				definition.LocationSLOsAnnotation: `{"/api/checkout": "critical", "/static": "low"}`,
+			},
+		},
+		Spec: v1alpha1.RpaasInstanceSpec{
+			Locations: []v1alpha1.Location{
+				{Path: "/api/checkout", Destination: "checkout"},
+				{Path: "/static", Destination: "static"},
+			},
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(rpaasInstance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log,
+	}
+
+	_, err := reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "instance1",
+		},
+	})
+	assert.NoError(t, err)
+
+	prometheusRule := monitoringv1.PrometheusRule{}
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1",
+	}, &prometheusRule)
+	require.Error(t, err)
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1.api-checkout",
+	}, &prometheusRule)
+	require.NoError(t, err)
+	require.Len(t, prometheusRule.Spec.Groups, 1)
+	assert.Len(t, prometheusRule.Spec.Groups[0].Rules, 4)
+	assert.Equal(t, "/api/checkout", prometheusRule.Spec.Groups[0].Rules[0].Labels["rpaas_location"])
+	assert.Equal(t, "critical", prometheusRule.Spec.Groups[0].Rules[0].Labels["slo_class"])
+
+	// the SLIs of the location are recorded out of the VTS filter
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slis-tsuru.default.instance1.api-checkout",
+	}, &prometheusRule)
+	require.NoError(t, err)
+	require.Len(t, prometheusRule.Spec.Groups, 3)
+	assert.Equal(t, "slo:tsuru.default.instance1.api-checkout:short", prometheusRule.Spec.Groups[0].Name)
+	errorsRecord := prometheusRule.Spec.Groups[0].Rules[0]
+	assert.Equal(t, "slo:service_errors_total:ratio_rate_5m", errorsRecord.Record)
+	assert.Equal(t, "tsuru.default.instance1.api-checkout", errorsRecord.Labels["service"])
+	assert.Equal(t, `sum(rate(nginx_vts_filter_requests_total{namespace="default",rpaas_instance="instance1",filter="location",filter_name="/api/checkout",direction="5xx"}[5m])) / `+
+		`sum(rate(nginx_vts_filter_requests_total{namespace="default",rpaas_instance="instance1",filter="location",filter_name="/api/checkout",direction="total"}[5m]))`,
+		errorsRecord.Expr.String())
+	latencyRecord := prometheusRule.Spec.Groups[0].Rules[1]
+	assert.Equal(t, "slo:service_latency:ratio_rate_5m", latencyRecord.Record)
+	assert.Equal(t, `sum(rate(nginx_vts_filter_request_duration_seconds_bucket{namespace="default",rpaas_instance="instance1",filter="location",filter_name="/api/checkout",le="`+latencyRecord.Labels["le"]+`"}[5m])) / `+
+		`sum(rate(nginx_vts_filter_request_duration_seconds_count{namespace="default",rpaas_instance="instance1",filter="location",filter_name="/api/checkout"}[5m]))`,
+		latencyRecord.Expr.String())
+	assert.NotEmpty(t, latencyRecord.Labels["le"])
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1.static",
+	}, &prometheusRule)
+	require.NoError(t, err)
+	require.Len(t, prometheusRule.Spec.Groups, 1)
+	assert.Len(t, prometheusRule.Spec.Groups[0].Rules, 2)
+	assert.Equal(t, "/static", prometheusRule.Spec.Groups[0].Rules[0].Labels["rpaas_location"])
+	assert.Equal(t, "low", prometheusRule.Spec.Groups[0].Rules[0].Labels["slo_class"])
+
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "instance1"}, rpaasInstance1)
+	require.NoError(t, err)
+	rpaasInstance1.Spec.Locations = rpaasInstance1.Spec.Locations[:1]
+	err = k8sClient.Update(ctx, rpaasInstance1)
+	require.NoError(t, err)
+
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "instance1",
+		},
+	})
+	assert.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1.static",
+	}, &prometheusRule)
+	require.Error(t, err)
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1.api-checkout",
+	}, &prometheusRule)
+	require.NoError(t, err)
+}
+
+func TestLocationSlug(t *testing.T) {
+	assert.Equal(t, "root", locationSlug("/"))
+	assert.Equal(t, "api-checkout", locationSlug("/api/checkout"))
+	assert.Equal(t, "static", locationSlug("/Static/"))
+	assert.Equal(t, "v1-users-id-0-9", locationSlug("~ ^/v1/users/(?<id>[0-9]+)$"))
+}
+
+func TestReconcileRpaasInstanceHostSLOs(t *testing.T) {
+	ctx := context.TODO()
+	rpaasInstance1 := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Labels: map[string]string{
+				rpaasTeamOwnerAnnotation:    "my-team",
+				rpaasInstanceNameAnnotation: "instance1",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+			},
+			Annotations: map[string]string{
+				rpaasTagsAnnotation:           "slo:critical",
+				definition.HostSLOsAnnotation: `{"www.example.com": "high", "static.example.com": "low"}`,
+			},
+		},
+	}
+
+	staleHostRule := &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "slos-alerts-tsuru.default.instance1.host.old.example.com",
+			Namespace: "default",
+			Labels: map[string]string{
+				rpaasTeamOwnerAnnotation:    "my-team",
+				rpaasInstanceNameAnnotation: "instance1",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+			},
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(rpaasInstance1, staleHostRule).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log,
+	}
+
+	_, err := reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "instance1",
+		},
+	})
+	assert.NoError(t, err)
+
+	prometheusRule := monitoringv1.PrometheusRule{}
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1",
+	}, &prometheusRule)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1.host.www.example.com",
+	}, &prometheusRule)
+	require.NoError(t, err)
+	require.Len(t, prometheusRule.Spec.Groups, 1)
+	assert.Equal(t, "slo:tsuru.default.instance1.host.www.example.com:alert", prometheusRule.Spec.Groups[0].Name)
+	assert.Equal(t, "www.example.com", prometheusRule.Spec.Groups[0].Rules[0].Labels["rpaas_host"])
+	assert.Equal(t, "high", prometheusRule.Spec.Groups[0].Rules[0].Labels["slo_class"])
+
+	// the SLIs of the host are recorded out of its VTS server zone
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slis-tsuru.default.instance1.host.www.example.com",
+	}, &prometheusRule)
+	require.NoError(t, err)
+	require.Len(t, prometheusRule.Spec.Groups, 3)
+	errorsRecord := prometheusRule.Spec.Groups[0].Rules[0]
+	assert.Equal(t, "slo:service_errors_total:ratio_rate_5m", errorsRecord.Record)
+	assert.Equal(t, "tsuru.default.instance1.host.www.example.com", errorsRecord.Labels["service"])
+	assert.Equal(t, "www.example.com", errorsRecord.Labels["rpaas_host"])
+	assert.Equal(t, `sum(rate(nginx_vts_server_requests_total{namespace="default",rpaas_instance="instance1",host="www.example.com",code="5xx"}[5m])) / `+
+		`sum(rate(nginx_vts_server_requests_total{namespace="default",rpaas_instance="instance1",host="www.example.com",code="total"}[5m]))`,
+		errorsRecord.Expr.String())
+	latencyRecord := prometheusRule.Spec.Groups[0].Rules[1]
+	assert.Equal(t, "slo:service_latency:ratio_rate_5m", latencyRecord.Record)
+	assert.Equal(t, `sum(rate(nginx_vts_server_request_duration_seconds_bucket{namespace="default",rpaas_instance="instance1",host="www.example.com",le="`+latencyRecord.Labels["le"]+`"}[5m])) / `+
+		`sum(rate(nginx_vts_server_request_duration_seconds_count{namespace="default",rpaas_instance="instance1",host="www.example.com"}[5m]))`,
+		latencyRecord.Expr.String())
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1.host.static.example.com",
+	}, &prometheusRule)
+	require.NoError(t, err)
+	assert.Equal(t, "static.example.com", prometheusRule.Spec.Groups[0].Rules[0].Labels["rpaas_host"])
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1.host.old.example.com",
+	}, &prometheusRule)
+	require.Error(t, err)
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+func TestReconcileRpaasInstanceMigrateDeprecatedClasses(t *testing.T) {
+	ctx := context.TODO()
+	rpaasInstance1 := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Labels: map[string]string{
+				rpaasTeamOwnerAnnotation:    "my-team",
+				rpaasInstanceNameAnnotation: "instance1",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+			},
+			Annotations: map[string]string{
+				rpaasTagsAnnotation: "slo:high_slow",
+			},
+		},
+	}
+
+	for _, migrate := range []bool{false, true} {
+		k8sClient := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithRuntimeObjects(rpaasInstance1).Build()
+		recorder := record.NewFakeRecorder(10)
+		reconciler := &RpaasInstanceReconciler{
+			MigrateDeprecatedClasses: migrate,
+			Client:                   k8sClient,
+			Log:                      ctrl.Log,
+			Recorder:                 recorder,
+		}
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "instance1",
+			},
+		})
+		assert.NoError(t, err)
+
+		prometheusRule := monitoringv1.PrometheusRule{}
+		err = k8sClient.Get(ctx, client.ObjectKey{
+			Namespace: "default",
+			Name:      "slos-alerts-tsuru.default.instance1",
+		}, &prometheusRule)
+		require.NoError(t, err)
+		require.Len(t, prometheusRule.Spec.Groups, 1)
+
+		if !migrate {
+			assert.Equal(t, "high_slow", prometheusRule.Spec.Groups[0].Rules[0].Labels["slo_class"])
+			assert.Empty(t, recorder.Events)
+			continue
+		}
+
+		assert.Equal(t, "high", prometheusRule.Spec.Groups[0].Rules[0].Labels["slo_class"])
+		require.Len(t, recorder.Events, 1)
+		assert.Equal(t, `Normal SLOClassMigrated SLO tsuru.default.instance1 uses the deprecated class "high_slow", generated with "high" instead`, <-recorder.Events)
+		assert.Equal(t, 1.0, testutil.ToFloat64(deprecatedClassMigrations.WithLabelValues("high_slow", "high")))
+
+		// neither reconciling again nor reading the rules migrates again
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(rpaasInstance1)})
+		require.NoError(t, err)
+		_, err = reconciler.DesiredPrometheusRules(ctx, rpaasInstance1)
+		require.NoError(t, err)
+		assert.Empty(t, recorder.Events)
+		assert.Equal(t, 1.0, testutil.ToFloat64(deprecatedClassMigrations.WithLabelValues("high_slow", "high")))
+
+		require.NoError(t, k8sClient.Delete(ctx, rpaasInstance1.DeepCopy()))
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(rpaasInstance1)})
+		require.NoError(t, err)
+		assert.Equal(t, 0.0, testutil.ToFloat64(deprecatedClassMigrations.WithLabelValues("high_slow", "high")))
+	}
+}
+
+func TestMigrateDeprecatedClassesKeepsSchedule(t *testing.T) {
+	rpaasInstance := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Annotations: map[string]string{
+				rpaasTagsAnnotation:               "slo:high_slow",
+				definition.ScheduleAnnotation:     `{"timezone": "UTC", "windows": [{"hours": "9-18", "class": "high_slow"}, {"hours": "18-22", "class": "critical"}]}`,
+				definition.LocationSLOsAnnotation: `{"/api": "high_slow"}`,
+			},
+		},
+		Spec: v1alpha1.RpaasInstanceSpec{
+			Locations: []v1alpha1.Location{{Path: "/api", Destination: "api"}},
+		},
+	}
+
+	slos, err := InstanceSLOs(rpaasInstance, nil)
+	require.NoError(t, err)
+	require.Len(t, slos, 2)
+
+	migrated := migrateDeprecatedClasses(slos)
+	require.Len(t, migrated, 2)
+
+	assert.Equal(t, "high", migrated[0].Class.Name)
+	assert.Equal(t, "high", migrated[0].SLO.Class)
+	assert.Equal(t, "high", migrated[0].SLO.Labels["slo_class"])
+	require.NotNil(t, migrated[0].Schedule)
+	require.Len(t, migrated[0].Schedule.Windows, 2)
+	assert.Equal(t, "high", migrated[0].Schedule.Windows[0].Class.Name)
+	assert.Equal(t, 9, migrated[0].Schedule.Windows[0].StartHour)
+	assert.Equal(t, "critical", migrated[0].Schedule.Windows[1].Class.Name)
+	require.Len(t, migrated[0].DeprecatedClasses, 2)
+	assert.Equal(t, "high_slow", migrated[0].DeprecatedClasses[0].Name)
+	assert.Equal(t, "high_slow", migrated[0].DeprecatedClasses[1].Name)
+
+	// location SLOs keep recording their own SLIs
+	assert.Equal(t, "high", migrated[1].Class.Name)
+	assert.Equal(t, slos[1].SLO.LatencyRecord.Expr, migrated[1].SLO.LatencyRecord.Expr)
+	assert.NotEmpty(t, migrated[1].SLO.LatencyRecord.Expr)
+	assert.Equal(t, "/api", migrated[1].SLO.Labels["rpaas_location"])
+
+	// the generated SLOs are left untouched
+	assert.Equal(t, "high_slow", slos[0].Class.Name)
+	assert.Equal(t, "high_slow", slos[0].SLO.Labels["slo_class"])
+	assert.Equal(t, "high_slow", slos[0].Schedule.Windows[0].Class.Name)
+
+	for _, prometheusRule := range migrated[0].PrometheusRules() {
+		for _, group := range prometheusRule.Spec.Groups {
+			for _, rule := range group.Rules {
+				assert.NotEqual(t, "high_slow", rule.Labels["slo_class"], rule.Alert)
+			}
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/globocom/slo-generator/slo"
+	"github.com/go-logr/logr"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	slov1alpha1 "github.com/tsuru/rpaas-slo-controller/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// sloGroupNameLabel identifies the PrometheusRules generated for a
+// RpaasSLOGroup.
+const sloGroupNameLabel = "slo.tsuru.io/group-name"
+
+var _ reconcile.Reconciler = &RpaasSLOGroupReconciler{}
+
+// RpaasSLOGroupReconciler reconciles a RpaasSLOGroup object
+type RpaasSLOGroupReconciler struct {
+	// InstanceSelector restricts the RpaasInstances eligible as members of
+	// any group, every instance is eligible when nil.
+	InstanceSelector labels.Selector
+
+	// RuleLabels are templates of labels added to the PrometheusRules, see
+	// RuleLabelsData.
+	RuleLabels map[string]*template.Template
+
+	client.Client
+	Log logr.Logger
+}
+
+func (r *RpaasSLOGroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	group := &slov1alpha1.RpaasSLOGroup{}
+	err := r.Client.Get(ctx, req.NamespacedName, group)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			// the PrometheusRules are removed by the garbage collector
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	sloClass, err := definition.Class(group.Spec.Class)
+	if err != nil {
+		r.Log.Error(err, "invalid SLO class of RpaasSLOGroup",
+			"name", req.Name,
+			"namespace", req.Namespace,
+		)
+		return ctrl.Result{}, nil
+	}
+
+	members, excluded, err := r.groupMembers(ctx, group)
+	if err != nil {
+		r.Log.Error(err, "could not list members of RpaasSLOGroup",
+			"name", req.Name,
+			"namespace", req.Namespace,
+		)
+		return ctrl.Result{}, err
+	}
+
+	if len(excluded) > 0 {
+		r.Log.Info("RpaasInstances without SLO class left out of RpaasSLOGroup",
+			"name", req.Name,
+			"namespace", req.Namespace,
+			"excluded", excluded,
+		)
+	}
+
+	var prometheusRules []monitoringv1.PrometheusRule
+	if len(members) > 0 {
+		groupSLO := GroupSLO(group, members, sloClass)
+		prometheusRules = groupSLO.PrometheusRules()
+	}
+
+	err = r.reconcilePrometheusRules(ctx, group, prometheusRules)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	memberNames := make([]string, 0, len(members))
+	for _, member := range members {
+		memberNames = append(memberNames, member.Namespace+"/"+member.Name)
+	}
+
+	if group.Status.ObservedGeneration == group.Generation &&
+		reflect.DeepEqual(group.Status.Members, memberNames) &&
+		reflect.DeepEqual(group.Status.Excluded, excluded) {
+		return ctrl.Result{}, nil
+	}
+
+	group.Status.ObservedGeneration = group.Generation
+	group.Status.Members = memberNames
+	group.Status.Excluded = excluded
+	err = r.Client.Status().Update(ctx, group)
+	if err != nil {
+		r.Log.Error(err, "could not update status of RpaasSLOGroup",
+			"name", req.Name,
+			"namespace", req.Namespace,
+		)
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// groupMembers returns the RpaasInstances selected by the group, sorted by
+// namespace and name, along with the selected instances excluded from the
+// group since they have no SLO class, as namespace/name. Instances being
+// deleted are not members anymore.
+func (r *RpaasSLOGroupReconciler) groupMembers(ctx context.Context, group *slov1alpha1.RpaasSLOGroup) ([]v1alpha1.RpaasInstance, []string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&group.Spec.InstanceSelector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// an empty selector selects no instance, rather than every instance of
+	// the cluster
+	if selector.Empty() {
+		return nil, nil, nil
+	}
+
+	if r.InstanceSelector != nil {
+		requirements, _ := r.InstanceSelector.Requirements()
+		selector = selector.Add(requirements...)
+	}
+
+	namespaces := group.Spec.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var members []v1alpha1.RpaasInstance
+	for _, namespace := range namespaces {
+		instances := v1alpha1.RpaasInstanceList{}
+		err = r.Client.List(ctx, &instances, &client.ListOptions{
+			Namespace:     namespace,
+			LabelSelector: selector,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, instance := range instances.Items {
+			if instance.DeletionTimestamp != nil {
+				continue
+			}
+			members = append(members, instance)
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Namespace != members[j].Namespace {
+			return members[i].Namespace < members[j].Namespace
+		}
+		return members[i].Name < members[j].Name
+	})
+
+	// the SLIs aggregated by the group are only recorded for instances with
+	// a SLO class
+	var measured []v1alpha1.RpaasInstance
+	var excluded []string
+	for _, member := range members {
+		if sloClass, _ := definition.SLOClass(&member); sloClass == nil {
+			excluded = append(excluded, member.Namespace+"/"+member.Name)
+			continue
+		}
+		measured = append(measured, member)
+	}
+
+	return measured, excluded, nil
+}
+
+func (r *RpaasSLOGroupReconciler) reconcilePrometheusRules(ctx context.Context, group *slov1alpha1.RpaasSLOGroup, prometheusRules []monitoringv1.PrometheusRule) error {
+	existingList := monitoringv1.PrometheusRuleList{}
+	err := r.Client.List(ctx, &existingList, &client.ListOptions{
+		Namespace: group.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			sloGroupNameLabel: group.Name,
+		}),
+	})
+	if err != nil {
+		r.Log.Error(err, "could not get PrometheusRules",
+			"name", group.Name,
+			"namespace", group.Namespace,
+		)
+		return err
+	}
+
+	existingPrometheusRulesSet := map[string]*monitoringv1.PrometheusRule{}
+	for _, existingPrometheusRule := range existingList.Items {
+		existingPrometheusRulesSet[existingPrometheusRule.Name] = existingPrometheusRule
+	}
+
+	for _, prometheusRule := range prometheusRules {
+		prometheusRule.Namespace = group.Namespace
+		prometheusRule.Labels = renderRuleLabels(r.Log, r.RuleLabels, RuleLabelsData{
+			Pool:      implicitPool(group.Namespace),
+			Namespace: group.Namespace,
+			Class:     group.Spec.Class,
+		})
+		prometheusRule.Labels[sloGroupNameLabel] = group.Name
+		prometheusRule.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(group, slov1alpha1.GroupVersion.WithKind("RpaasSLOGroup")),
+		}
+
+		existing := existingPrometheusRulesSet[prometheusRule.Name]
+		if existing == nil {
+			err = r.Client.Create(ctx, &prometheusRule)
+			if err != nil {
+				r.Log.Error(err, "could not create PrometheusRule",
+					"name", prometheusRule.Name,
+					"namespace", prometheusRule.Namespace,
+				)
+				return err
+			}
+
+			r.Log.Info("created PrometheusRule",
+				"name", prometheusRule.Name,
+				"namespace", prometheusRule.Namespace)
+			continue
+		}
+
+		delete(existingPrometheusRulesSet, prometheusRule.Name)
+		prometheusRule.ResourceVersion = existing.ResourceVersion
+		err = r.Client.Update(ctx, &prometheusRule)
+		if err != nil {
+			r.Log.Error(err, "could not update PrometheusRule",
+				"name", prometheusRule.Name,
+				"namespace", prometheusRule.Namespace,
+			)
+			return err
+		}
+	}
+
+	for _, existingPrometheusRule := range existingPrometheusRulesSet {
+		err = r.Client.Delete(ctx, existingPrometheusRule)
+		if err != nil {
+			r.Log.Error(err, "could not remove unused PrometheusRule",
+				"name", existingPrometheusRule.Name,
+				"namespace", existingPrometheusRule.Namespace,
+			)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GroupSLOName returns the name of the SLO of a RpaasSLOGroup, which is also
+// the service label of its SLIs.
+func GroupSLOName(group *slov1alpha1.RpaasSLOGroup) string {
+	return "tsuru-group." + group.Namespace + "." + group.Name
+}
+
+// GroupSLO returns the SLO aggregating the SLIs of the members of a group.
+// The group is as available as its least available member, and as fast as
+// its slowest one, so the recording rules take the worst SLI among the
+// members on each window.
+func GroupSLO(group *slov1alpha1.RpaasSLOGroup, members []v1alpha1.RpaasInstance, sloClass *slo.Class) InstanceSLO {
+	services := make([]string, 0, len(members))
+	for i := range members {
+		services = append(services, regexp.QuoteMeta(InstanceSLOName(&members[i])))
+	}
+	servicesRegexp := fmt.Sprintf("%q", strings.Join(services, "|"))
+
+	s := newInstanceSLO(GroupSLOName(group), sloClass, map[string]string{
+		"slo_class": sloClass.Name,
+		"slo_group": group.Name,
+	}, nil)
+	s.SLO.ErrorRateRecord.Expr = fmt.Sprintf(`max(slo:service_errors_total:ratio_rate_$window{service=~%s})`, servicesRegexp)
+	s.SLO.LatencyRecord.Expr = fmt.Sprintf(`min(slo:service_latency:ratio_rate_$window{service=~%s,le="$le"})`, servicesRegexp)
+
+	return s
+}
+
+func (r *RpaasSLOGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&slov1alpha1.RpaasSLOGroup{}).
+		Owns(&monitoringv1.PrometheusRule{}).
+		Watches(&source.Kind{Type: &v1alpha1.RpaasInstance{}}, handler.EnqueueRequestsFromMapFunc(r.groupsOfInstance),
+			builder.WithPredicates(instanceSelectorPredicate(r.InstanceSelector), relevantChangesPredicate())).
+		Complete(r)
+}
+
+// groupsOfInstance maps a RpaasInstance to the groups selecting it, keeping
+// the membership in sync as instances are created, changed and deleted.
+func (r *RpaasSLOGroupReconciler) groupsOfInstance(obj client.Object) []reconcile.Request {
+	groups := slov1alpha1.RpaasSLOGroupList{}
+	err := r.Client.List(context.Background(), &groups)
+	if err != nil {
+		r.Log.Error(err, "could not list RpaasSLOGroups")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, group := range groups.Items {
+		if !groupSelects(&group, obj) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&group),
+		})
+	}
+
+	return requests
+}
+
+// groupSelects returns whether the object matches the selector of the group,
+// regardless of the current membership.
+func groupSelects(group *slov1alpha1.RpaasSLOGroup, obj client.Object) bool {
+	if len(group.Spec.Namespaces) > 0 {
+		found := false
+		for _, namespace := range group.Spec.Namespaces {
+			if namespace == obj.GetNamespace() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&group.Spec.InstanceSelector)
+	if err != nil {
+		return false
+	}
+
+	if !selector.Empty() && selector.Matches(labels.Set(obj.GetLabels())) {
+		return true
+	}
+
+	// instances whose labels changed must leave the groups they belong to
+	key := obj.GetNamespace() + "/" + obj.GetName()
+	for _, members := range [][]string{group.Status.Members, group.Status.Excluded} {
+		for _, member := range members {
+			if member == key {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	slov1alpha1 "github.com/tsuru/rpaas-slo-controller/api/v1alpha1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func init() {
+	_ = slov1alpha1.AddToScheme(scheme)
+}
+
+func TestReconcileRpaasSLOGroup(t *testing.T) {
+	ctx := context.TODO()
+	instance := func(namespace, name, product string) *v1alpha1.RpaasInstance {
+		return &v1alpha1.RpaasInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Labels: map[string]string{
+					"product": product,
+				},
+				Annotations: map[string]string{
+					rpaasTagsAnnotation: "slo:high",
+				},
+			},
+		}
+	}
+
+	group := &slov1alpha1.RpaasSLOGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "checkout",
+			Generation: 1,
+		},
+		Spec: slov1alpha1.RpaasSLOGroupSpec{
+			InstanceSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"product": "checkout"},
+			},
+			Namespaces: []string{"rpaasv2-fe-pool1", "rpaasv2-be-pool1"},
+			Class:      "high",
+		},
+	}
+
+	frontend := instance("rpaasv2-fe-pool1", "checkout-fe", "checkout")
+	untagged := instance("rpaasv2-fe-pool1", "checkout-static", "checkout")
+	untagged.Annotations = nil
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			group,
+			frontend,
+			untagged,
+			instance("rpaasv2-be-pool1", "checkout-be", "checkout"),
+			instance("rpaasv2-be-pool1", "search-be", "search"),
+			instance("default", "checkout-other", "checkout"),
+		).Build()
+	reconciler := &RpaasSLOGroupReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log,
+	}
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "checkout",
+		},
+	}
+	_, err := reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, request.NamespacedName, group)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rpaasv2-be-pool1/checkout-be", "rpaasv2-fe-pool1/checkout-fe"}, group.Status.Members)
+	assert.Equal(t, []string{"rpaasv2-fe-pool1/checkout-static"}, group.Status.Excluded)
+
+	recordingRules := monitoringv1.PrometheusRule{}
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slis-tsuru-group.default.checkout",
+	}, &recordingRules)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{sloGroupNameLabel: "checkout"}, recordingRules.Labels)
+	require.Len(t, recordingRules.OwnerReferences, 1)
+	assert.Equal(t, "RpaasSLOGroup", recordingRules.OwnerReferences[0].Kind)
+
+	require.NotEmpty(t, recordingRules.Spec.Groups)
+	rules := recordingRules.Spec.Groups[0].Rules
+	require.Len(t, rules, 9)
+	assert.Equal(t, "slo:service_errors_total:ratio_rate_5m", rules[0].Record)
+	assert.Equal(t, `max(slo:service_errors_total:ratio_rate_5m{service=~"tsuru\\.rpaasv2-be-pool1\\.checkout-be|tsuru\\.rpaasv2-fe-pool1\\.checkout-fe"})`, rules[0].Expr.String())
+	assert.Equal(t, "tsuru-group.default.checkout", rules[0].Labels["service"])
+	assert.Equal(t, "slo:service_latency:ratio_rate_5m", rules[1].Record)
+	assert.Equal(t, `min(slo:service_latency:ratio_rate_5m{service=~"tsuru\\.rpaasv2-be-pool1\\.checkout-be|tsuru\\.rpaasv2-fe-pool1\\.checkout-fe",le="1.000"})`, rules[1].Expr.String())
+	assert.Equal(t, "1.000", rules[1].Labels["le"])
+
+	alertRules := monitoringv1.PrometheusRule{}
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru-group.default.checkout",
+	}, &alertRules)
+	require.NoError(t, err)
+	require.Len(t, alertRules.Spec.Groups, 1)
+	assert.Equal(t, "checkout", alertRules.Spec.Groups[0].Rules[0].Labels["slo_group"])
+	assert.Equal(t, "high", alertRules.Spec.Groups[0].Rules[0].Labels["slo_class"])
+
+	assert.Equal(t, []ctrl.Request{request}, reconciler.groupsOfInstance(frontend))
+	assert.Equal(t, []ctrl.Request{request}, reconciler.groupsOfInstance(instance("rpaasv2-fe-pool1", "checkout-static", "static")))
+	assert.Empty(t, reconciler.groupsOfInstance(instance("rpaasv2-be-pool1", "search-be", "search")))
+
+	err = k8sClient.DeleteAllOf(ctx, &v1alpha1.RpaasInstance{}, client.InNamespace("rpaasv2-fe-pool1"))
+	require.NoError(t, err)
+	err = k8sClient.DeleteAllOf(ctx, &v1alpha1.RpaasInstance{}, client.InNamespace("rpaasv2-be-pool1"))
+	require.NoError(t, err)
+
+	_, err = reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, request.NamespacedName, group)
+	require.NoError(t, err)
+	assert.Empty(t, group.Status.Members)
+	assert.Empty(t, group.Status.Excluded)
+
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru-group.default.checkout",
+	}, &alertRules)
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+func TestReconcileRpaasSLOGroupEmptySelector(t *testing.T) {
+	ctx := context.TODO()
+	group := &slov1alpha1.RpaasSLOGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "everything",
+			Generation: 1,
+		},
+		Spec: slov1alpha1.RpaasSLOGroupSpec{
+			Class: "high",
+		},
+	}
+
+	instance := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Annotations: map[string]string{
+				rpaasTagsAnnotation: "slo:high",
+			},
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(group, instance).Build()
+	reconciler := &RpaasSLOGroupReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log,
+	}
+
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(group)}
+	_, err := reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, request.NamespacedName, group)
+	require.NoError(t, err)
+	assert.Empty(t, group.Status.Members)
+	assert.Empty(t, reconciler.groupsOfInstance(instance))
+
+	prometheusRules := monitoringv1.PrometheusRuleList{}
+	err = k8sClient.List(ctx, &prometheusRules)
+	require.NoError(t, err)
+	assert.Empty(t, prometheusRules.Items)
+}
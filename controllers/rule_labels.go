@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"text/template"
+
+	"github.com/go-logr/logr"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RuleLabelsData is the data of the RuleLabels templates. Class and Team are
+// empty on PrometheusRule shards, which hold the rules of several instances,
+// and Team is empty on RpaasSLOGroups.
+type RuleLabelsData struct {
+	// Pool is the tsuru pool of the instance, if any.
+	Pool string
+	// Namespace is the namespace of the PrometheusRule.
+	Namespace string
+	Class     string
+	Team      string
+}
+
+// ParseRuleLabels parses the templates of the PrometheusRule labels, eg:
+// "prometheus" => "pool-{{ .Pool }}".
+func ParseRuleLabels(raw map[string]string) (map[string]*template.Template, error) {
+	result := map[string]*template.Template{}
+	for key, value := range raw {
+		tpl, err := template.New(key).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = tpl
+	}
+	return result, nil
+}
+
+// renderRuleLabels executes the templates of the PrometheusRule labels, labels
+// whose template fails are skipped and logged.
+func renderRuleLabels(log logr.Logger, templates map[string]*template.Template, data RuleLabelsData) map[string]string {
+	result := map[string]string{}
+	for key, tpl := range templates {
+		var buf bytes.Buffer
+		err := tpl.Execute(&buf, data)
+		if err != nil {
+			log.Error(err, "could not generate PrometheusRule label",
+				"label", key,
+				"rulesNamespace", data.Namespace,
+			)
+			continue
+		}
+		result[key] = buf.String()
+	}
+	return result
+}
+
+func (r *RpaasInstanceReconciler) ruleLabels(rpaasInstance *v1alpha1.RpaasInstance, class string) map[string]string {
+	data := RuleLabelsData{
+		Pool:      implicitPool(rpaasInstance.Namespace),
+		Namespace: implicitNamespace(rpaasInstance.Namespace),
+		Class:     class,
+	}
+	if class != "" {
+		data.Team = alertTeamOwner(rpaasInstance)
+	}
+
+	return renderRuleLabels(r.Log, r.RuleLabels, data)
+}
+
+// warnUnselectedRules emits a warning event on the instance when none of the
+// Prometheus objects selects the PrometheusRule, per their ruleSelector and
+// ruleNamespaceSelector. The Prometheus objects and the namespace are read
+// through APIReader, since they usually live out of the cached namespaces.
+// Failures to look up the Prometheus objects are only logged.
+func (r *RpaasInstanceReconciler) warnUnselectedRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, prometheusRule *monitoringv1.PrometheusRule) {
+	log := r.logger(ctx)
+
+	if !r.WarnUnselectedRules {
+		return
+	}
+
+	selected, err := prometheusSelects(ctx, r.apiReader(), prometheusRule)
+	if err != nil {
+		log.Error(err, "could not check the Prometheus selecting the PrometheusRule",
+			"rule", prometheusRule.Name,
+			"rulesNamespace", prometheusRule.Namespace,
+		)
+		return
+	}
+
+	if len(selected) > 0 {
+		return
+	}
+
+	log.Info("no Prometheus selects the PrometheusRule",
+		"rule", prometheusRule.Name,
+		"rulesNamespace", prometheusRule.Namespace,
+	)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(rpaasInstance, corev1.EventTypeWarning, "RulesNotSelected",
+			"PrometheusRule %s/%s is not selected by any Prometheus", prometheusRule.Namespace, prometheusRule.Name)
+	}
+}
+
+// prometheusSelects returns the Prometheus objects, as namespace/name,
+// selecting the PrometheusRule.
+func prometheusSelects(ctx context.Context, c client.Reader, prometheusRule *monitoringv1.PrometheusRule) ([]string, error) {
+	list := monitoringv1.PrometheusList{}
+	err := c.List(ctx, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaceLabels labels.Set
+	namespaceFetched := false
+	var result []string
+	for _, prometheus := range list.Items {
+		// a nil ruleSelector selects no rules at all
+		if prometheus.Spec.RuleSelector == nil {
+			continue
+		}
+
+		ruleSelector, err := metav1.LabelSelectorAsSelector(prometheus.Spec.RuleSelector)
+		if err != nil || !ruleSelector.Matches(labels.Set(prometheusRule.Labels)) {
+			continue
+		}
+
+		if prometheus.Spec.RuleNamespaceSelector == nil {
+			if prometheus.Namespace == prometheusRule.Namespace {
+				result = append(result, prometheus.Namespace+"/"+prometheus.Name)
+			}
+			continue
+		}
+
+		namespaceSelector, err := metav1.LabelSelectorAsSelector(prometheus.Spec.RuleNamespaceSelector)
+		if err != nil {
+			continue
+		}
+
+		if !namespaceFetched && !namespaceSelector.Empty() {
+			namespace := corev1.Namespace{}
+			err = c.Get(ctx, client.ObjectKey{Name: prometheusRule.Namespace}, &namespace)
+			if err != nil {
+				return nil, err
+			}
+			namespaceLabels = labels.Set(namespace.Labels)
+			namespaceFetched = true
+		}
+
+		if namespaceSelector.Matches(namespaceLabels) {
+			result = append(result, prometheus.Namespace+"/"+prometheus.Name)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
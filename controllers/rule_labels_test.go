@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileRpaasInstanceRuleLabels(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+	instance1.Annotations[rpaasTeamOwnerAnnotation] = "my-team"
+
+	ruleLabels, err := ParseRuleLabels(map[string]string{
+		"prometheus": "pool-{{ .Pool }}",
+		"tier":       "{{ .Class }}-{{ .Team }}",
+	})
+	require.NoError(t, err)
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client:     k8sClient,
+		Log:        ctrl.Log,
+		RuleLabels: ruleLabels,
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)}
+
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	prometheusRule := monitoringv1.PrometheusRule{}
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slos-alerts-tsuru.rpaasv2-fe-pool1.instance1"}, &prometheusRule)
+	require.NoError(t, err)
+	assert.Equal(t, "pool-pool1", prometheusRule.Labels["prometheus"])
+	assert.Equal(t, "critical-my-team", prometheusRule.Labels["tier"])
+	assert.Equal(t, "instance1", prometheusRule.Labels[rpaasInstanceNameAnnotation])
+
+	reconciler.RulesShardMaxSize = 1024 * 1024
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slos-shard-0"}, &prometheusRule)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"prometheus":    "pool-pool1",
+		"tier":          "-",
+		rulesShardLabel: "true",
+		tsuruPoolLabel:  "pool1",
+	}, prometheusRule.Labels)
+}
+
+func TestParseRuleLabelsInvalid(t *testing.T) {
+	_, err := ParseRuleLabels(map[string]string{"prometheus": "pool-{{ .Pool"})
+	assert.Error(t, err)
+}
+
+func TestPrometheusSelects(t *testing.T) {
+	ctx := context.TODO()
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "tsuru-pool1",
+			Labels: map[string]string{"monitoring": "slo"},
+		},
+	}
+
+	newPrometheus := func(namespace, name string, ruleSelector, ruleNamespaceSelector *metav1.LabelSelector) *monitoringv1.Prometheus {
+		return &monitoringv1.Prometheus{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: monitoringv1.PrometheusSpec{
+				RuleSelector:          ruleSelector,
+				RuleNamespaceSelector: ruleNamespaceSelector,
+			},
+		}
+	}
+	pool1 := &metav1.LabelSelector{MatchLabels: map[string]string{"prometheus": "pool-pool1"}}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			namespace,
+			newPrometheus("monitoring", "no-rules", nil, &metav1.LabelSelector{}),
+			newPrometheus("monitoring", "pool1", pool1, &metav1.LabelSelector{MatchLabels: map[string]string{"monitoring": "slo"}}),
+			newPrometheus("monitoring", "pool1-own-namespace", pool1, nil),
+			newPrometheus("tsuru-pool1", "local", pool1, nil),
+			newPrometheus("monitoring", "pool2", &metav1.LabelSelector{MatchLabels: map[string]string{"prometheus": "pool-pool2"}}, &metav1.LabelSelector{}),
+			newPrometheus("monitoring", "other-namespaces", pool1, &metav1.LabelSelector{MatchLabels: map[string]string{"monitoring": "other"}}),
+		).Build()
+
+	prometheusRule := &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "tsuru-pool1",
+			Name:      "slos-alerts-tsuru.rpaasv2-fe-pool1.instance1",
+			Labels:    map[string]string{"prometheus": "pool-pool1"},
+		},
+	}
+
+	selected, err := prometheusSelects(ctx, k8sClient, prometheusRule)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"monitoring/pool1", "tsuru-pool1/local"}, selected)
+}
+
+func TestReconcileRpaasInstanceWarnUnselectedRules(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1).Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &RpaasInstanceReconciler{
+		Client:              k8sClient,
+		Log:                 ctrl.Log,
+		Recorder:            recorder,
+		WarnUnselectedRules: true,
+	}
+
+	_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)})
+	require.NoError(t, err)
+
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Warning RulesNotSelected PrometheusRule tsuru-pool1/slos-alerts-tsuru.rpaasv2-fe-pool1.instance1 is not selected by any Prometheus", <-recorder.Events)
+}
+
+func TestReconcileRpaasInstanceWarnUnselectedRulesNamespacedCache(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			instance1,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tsuru-pool1", Labels: map[string]string{"monitoring": "slo"}}},
+			&monitoringv1.Prometheus{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "pool1"},
+				Spec: monitoringv1.PrometheusSpec{
+					RuleSelector:          &metav1.LabelSelector{},
+					RuleNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"monitoring": "slo"}},
+				},
+			},
+		).Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &RpaasInstanceReconciler{
+		// the Prometheus objects and the namespaces are out of the cache
+		Client:              newNamespacedCacheClient(t, fakeClient, []string{"rpaasv2-fe-pool1", "tsuru-pool1"}),
+		APIReader:           fakeClient,
+		Log:                 ctrl.Log,
+		Recorder:            recorder,
+		WarnUnselectedRules: true,
+	}
+
+	_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)})
+	require.NoError(t, err)
+
+	assert.Empty(t, recorder.Events)
+}
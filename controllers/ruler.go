@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// RulerRulesBackend pushes the rule groups to the rules API of a Cortex,
+// Mimir or Loki ruler, on the ruler namespace named after the rules
+// namespace of the instance. Groups are prefixed with the namespace and name
+// of the instance, so the groups of other instances are never touched.
+type RulerRulesBackend struct {
+	// URL is the address of the rules API, eg:
+	// http://mimir/prometheus/config/v1/rules or http://cortex/api/v1/rules.
+	URL string
+	// Tenant is sent on the X-Scope-OrgID header, when set.
+	Tenant string
+	Client *http.Client
+}
+
+var _ RulesBackend = &RulerRulesBackend{}
+
+func (b *RulerRulesBackend) ApplyRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, prometheusRules []monitoringv1.PrometheusRule) error {
+	namespace := rulesNamespace(ctx, rpaasInstance)
+	prefix := instanceGroupPrefix(rpaasInstance)
+
+	existing, err := b.ruleGroups(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	current := map[string]string{}
+	for _, group := range existing {
+		if !strings.HasPrefix(group.Name, prefix) {
+			continue
+		}
+		data, err := yaml.Marshal(group)
+		if err != nil {
+			return err
+		}
+		current[group.Name] = string(data)
+	}
+
+	for _, group := range instanceRuleGroups(rpaasInstance, prometheusRules) {
+		data, err := yaml.Marshal(group)
+		if err != nil {
+			return err
+		}
+
+		currentData, found := current[group.Name]
+		delete(current, group.Name)
+		if found && currentData == string(data) {
+			continue
+		}
+
+		err = b.do(ctx, http.MethodPost, b.URL+"/"+url.PathEscape(namespace), data)
+		if err != nil {
+			return fmt.Errorf("could not set rule group %q: %w", group.Name, err)
+		}
+	}
+
+	for name := range current {
+		err = b.do(ctx, http.MethodDelete, b.URL+"/"+url.PathEscape(namespace)+"/"+url.PathEscape(name), nil)
+		if err != nil {
+			return fmt.Errorf("could not remove rule group %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// ruleGroups returns the rule groups of the ruler namespace, the rules API
+// answers not found for namespaces without groups.
+func (b *RulerRulesBackend) ruleGroups(ctx context.Context, namespace string) ([]monitoringv1.RuleGroup, error) {
+	req, err := b.newRequest(ctx, http.MethodGet, b.URL+"/"+url.PathEscape(namespace), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not get rule groups of namespace %q: %s: %s", namespace, resp.Status, data)
+	}
+
+	groups := map[string][]monitoringv1.RuleGroup{}
+	err = yaml.Unmarshal(data, &groups)
+	if err != nil {
+		return nil, err
+	}
+
+	return groups[namespace], nil
+}
+
+func (b *RulerRulesBackend) do(ctx context.Context, method, address string, body []byte) error {
+	req, err := b.newRequest(ctx, method, address, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, data)
+	}
+
+	return nil
+}
+
+func (b *RulerRulesBackend) newRequest(ctx context.Context, method, address string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, address, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/yaml")
+	}
+	if b.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", b.Tenant)
+	}
+
+	return req, nil
+}
+
+func (b *RulerRulesBackend) httpClient() *http.Client {
+	if b.Client != nil {
+		return b.Client
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// RulesBackendPrometheusRule stores the rules as PrometheusRules.
+	RulesBackendPrometheusRule = "prometheus-rule"
+	// RulesBackendConfigMap stores the rules as rule files on ConfigMaps.
+	RulesBackendConfigMap = "configmap"
+	// RulesBackendRuler pushes the rules to a Cortex/Mimir/Loki ruler API.
+	RulesBackendRuler = "ruler"
+
+	// rulesFilesLabel identifies the ConfigMaps holding Prometheus rule files.
+	rulesFilesLabel = "slo.tsuru.io/rule-files"
+)
+
+// RulesBackends are all the supported rules backends.
+var RulesBackends = []string{RulesBackendPrometheusRule, RulesBackendConfigMap, RulesBackendRuler}
+
+// RulesBackend stores the rules generated for the SLOs of the instances.
+type RulesBackend interface {
+	// ApplyRules makes the rules of the instance on the backend match the
+	// groups of the given PrometheusRules, removing the ones not given
+	// anymore. Every rule of the instance is removed when none is given.
+	ApplyRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, prometheusRules []monitoringv1.PrometheusRule) error
+}
+
+func (r *RpaasInstanceReconciler) rulesBackend() RulesBackend {
+	if r.RulesBackend != nil {
+		return r.RulesBackend
+	}
+
+	return &prometheusRuleBackend{r: r}
+}
+
+// removeStaleRules removes the rules of the instance left on the backends
+// other than the configured one, eg: after changing the rules backend. Groups
+// pushed to a ruler are not tracked on the cluster, so they are left behind.
+func (r *RpaasInstanceReconciler) removeStaleRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) error {
+	backend := r.rulesBackend()
+
+	if _, isDefault := backend.(*prometheusRuleBackend); !isDefault {
+		err := r.removePrometheusRules(ctx, rpaasInstance)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, isConfigMap := backend.(*ConfigMapRulesBackend); !isConfigMap {
+		configMaps := &ConfigMapRulesBackend{Client: r.Client, Log: r.Log}
+		return configMaps.ApplyRules(ctx, rpaasInstance, nil)
+	}
+
+	return nil
+}
+
+// removePrometheusRules removes the PrometheusRules of the instance and its
+// groups on shards, clusters without the prometheus-operator are ignored.
+func (r *RpaasInstanceReconciler) removePrometheusRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) error {
+	_, err := r.existingPrometheusRules(ctx, rpaasInstance)
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		r.logger(ctx).Error(err, "could not get PrometheusRules")
+		return err
+	}
+
+	err = r.reconcileRulesShards(ctx, rpaasInstance, nil)
+	if err != nil {
+		return err
+	}
+
+	return r.deletePrometheusRules(ctx, rpaasInstance)
+}
+
+// prometheusRuleBackend keeps PrometheusRules for the prometheus-operator,
+// it is the default backend.
+type prometheusRuleBackend struct {
+	r *RpaasInstanceReconciler
+}
+
+func (b *prometheusRuleBackend) ApplyRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, prometheusRules []monitoringv1.PrometheusRule) error {
+	return b.r.reconcilePrometheusRules(ctx, rpaasInstance, prometheusRules)
+}
+
+// ConfigMapRulesBackend keeps a ConfigMap for each instance, on its rules
+// namespace, holding a Prometheus rule file for each PrometheusRule, for
+// Prometheus servers not managed by the prometheus-operator.
+type ConfigMapRulesBackend struct {
+	client.Client
+	Log logr.Logger
+}
+
+var _ RulesBackend = &ConfigMapRulesBackend{}
+
+func rulesConfigMapName(rpaasInstance *v1alpha1.RpaasInstance) string {
+	return "slo-rules-" + InstanceSLOName(rpaasInstance)
+}
+
+type rulesFile struct {
+	Groups []monitoringv1.RuleGroup `json:"groups"`
+}
+
+func (b *ConfigMapRulesBackend) ApplyRules(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, prometheusRules []monitoringv1.PrometheusRule) error {
+	log := loggerFrom(ctx, b.Log)
+
+	desired := &corev1.ConfigMap{}
+	desired.Name = rulesConfigMapName(rpaasInstance)
+	desired.Namespace = rulesNamespace(ctx, rpaasInstance)
+	desired.Labels = ownedObjectLabels(rpaasInstance, map[string]string{rulesFilesLabel: "true"})
+	desired.OwnerReferences = ownerReferences(rpaasInstance, desired.Namespace)
+	desired.Data = map[string]string{}
+
+	for _, prometheusRule := range prometheusRules {
+		data, err := yaml.Marshal(rulesFile{Groups: prometheusRule.Spec.Groups})
+		if err != nil {
+			return err
+		}
+		desired.Data[prometheusRule.Name+".yaml"] = string(data)
+	}
+
+	existing := &corev1.ConfigMap{}
+	err := b.Client.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		log.Error(err, "could not get rules ConfigMap",
+			"object", desired.Name,
+			"rulesNamespace", desired.Namespace,
+		)
+		return err
+	}
+	found := err == nil
+
+	switch {
+	case len(prometheusRules) == 0 && !found:
+		return nil
+
+	case len(prometheusRules) == 0:
+		err = b.Client.Delete(ctx, existing)
+		if err != nil {
+			log.Error(err, "could not remove unused rules ConfigMap",
+				"object", desired.Name,
+				"rulesNamespace", desired.Namespace,
+			)
+		}
+		return err
+
+	case !found:
+		err = b.Client.Create(ctx, desired)
+		if err != nil {
+			log.Error(err, "could not create rules ConfigMap",
+				"object", desired.Name,
+				"rulesNamespace", desired.Namespace,
+			)
+			return err
+		}
+
+		log.Info("created rules ConfigMap",
+			"object", desired.Name,
+			"rulesNamespace", desired.Namespace)
+		return nil
+	}
+
+	desired.ResourceVersion = existing.ResourceVersion
+	err = b.Client.Update(ctx, desired)
+	if err != nil {
+		log.Error(err, "could not update rules ConfigMap",
+			"object", desired.Name,
+			"rulesNamespace", desired.Namespace,
+		)
+	}
+	return err
+}
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func TestReconcileRpaasInstanceConfigMapRulesBackend(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client:       k8sClient,
+		Log:          ctrl.Log,
+		OutputModes:  []string{OutputPrometheusRules, OutputOpenSLO},
+		RulesBackend: &ConfigMapRulesBackend{Client: k8sClient, Log: ctrl.Log},
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)}
+
+	_, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	// reconciling again keeps both the rule files and the OpenSLO documents
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	configMap := corev1.ConfigMap{}
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slo-rules-tsuru.rpaasv2-fe-pool1.instance1"}, &configMap)
+	require.NoError(t, err)
+	assert.Equal(t, "true", configMap.Labels[rulesFilesLabel])
+	assert.Equal(t, "instance1", configMap.Labels[rpaasInstanceNameAnnotation])
+	require.Contains(t, configMap.Data, "slos-alerts-tsuru.rpaasv2-fe-pool1.instance1.yaml")
+
+	file := rulesFile{}
+	require.NoError(t, yaml.Unmarshal([]byte(configMap.Data["slos-alerts-tsuru.rpaasv2-fe-pool1.instance1.yaml"]), &file))
+	require.Len(t, file.Groups, 1)
+	assert.Equal(t, "slo:tsuru.rpaasv2-fe-pool1.instance1:alert", file.Groups[0].Name)
+
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "openslo-tsuru.rpaasv2-fe-pool1.instance1"}, &corev1.ConfigMap{})
+	require.NoError(t, err)
+
+	list := monitoringv1.PrometheusRuleList{}
+	require.NoError(t, k8sClient.List(ctx, &list))
+	assert.Empty(t, list.Items)
+
+	require.NoError(t, k8sClient.Delete(ctx, instance1))
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slo-rules-tsuru.rpaasv2-fe-pool1.instance1"}, &corev1.ConfigMap{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+func TestReconcileRpaasInstanceRulesBackendSwitch(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client:            k8sClient,
+		Log:               ctrl.Log,
+		RulesShardMaxSize: 1024 * 1024,
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)}
+
+	_, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	// the shard left by the default backend is removed
+	reconciler.RulesBackend = &ConfigMapRulesBackend{Client: k8sClient, Log: ctrl.Log}
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	list := monitoringv1.PrometheusRuleList{}
+	require.NoError(t, k8sClient.List(ctx, &list))
+	assert.Empty(t, list.Items)
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slo-rules-tsuru.rpaasv2-fe-pool1.instance1"}, &corev1.ConfigMap{})
+	require.NoError(t, err)
+
+	// the rule files are removed when switching back
+	reconciler.RulesBackend = nil
+	reconciler.RulesShardMaxSize = 0
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slo-rules-tsuru.rpaasv2-fe-pool1.instance1"}, &corev1.ConfigMap{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+	list = monitoringv1.PrometheusRuleList{}
+	require.NoError(t, k8sClient.List(ctx, &list))
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "slos-alerts-tsuru.rpaasv2-fe-pool1.instance1", list.Items[0].Name)
+}
+
+// fakeRuler implements the rules API of Cortex/Mimir rulers.
+type fakeRuler struct {
+	sync.Mutex
+	groups   map[string]map[string]monitoringv1.RuleGroup
+	tenants  []string
+	requests []string
+}
+
+func newFakeRuler() *fakeRuler {
+	return &fakeRuler{groups: map[string]map[string]monitoringv1.RuleGroup{}}
+}
+
+func (f *fakeRuler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.tenants = append(f.tenants, req.Header.Get("X-Scope-OrgID"))
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.EscapedPath(), "/api/v1/rules/"), "/", 2)
+	namespace := parts[0]
+
+	switch req.Method {
+	case http.MethodGet:
+		if len(f.groups[namespace]) == 0 {
+			http.Error(w, "no rule groups found", http.StatusNotFound)
+			return
+		}
+		var groups []monitoringv1.RuleGroup
+		for _, group := range f.groups[namespace] {
+			groups = append(groups, group)
+		}
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+		data, _ := yaml.Marshal(map[string][]monitoringv1.RuleGroup{namespace: groups})
+		w.Write(data)
+
+	case http.MethodPost:
+		data, _ := ioutil.ReadAll(req.Body)
+		group := monitoringv1.RuleGroup{}
+		if err := yaml.Unmarshal(data, &group); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.groups[namespace] == nil {
+			f.groups[namespace] = map[string]monitoringv1.RuleGroup{}
+		}
+		f.groups[namespace][group.Name] = group
+		f.requests = append(f.requests, "POST "+group.Name)
+		w.WriteHeader(http.StatusAccepted)
+
+	case http.MethodDelete:
+		name, _ := url.PathUnescape(parts[1])
+		delete(f.groups[namespace], name)
+		f.requests = append(f.requests, "DELETE "+name)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (f *fakeRuler) groupNames(namespace string) []string {
+	f.Lock()
+	defer f.Unlock()
+
+	var names []string
+	for name := range f.groups[namespace] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRulerRulesBackend(t *testing.T) {
+	ctx := context.TODO()
+	ruler := newFakeRuler()
+	ruler.groups["tsuru-pool1"] = map[string]monitoringv1.RuleGroup{
+		"other": {Name: "other", Rules: []monitoringv1.Rule{}},
+	}
+	server := httptest.NewServer(ruler)
+	defer server.Close()
+
+	instance1 := newShardedInstance("instance1")
+	instance1.Spec.Locations = append(instance1.Spec.Locations, v1alpha1.Location{Path: "/api"})
+	instance1.Annotations[definition.LocationSLOsAnnotation] = `{"/api": "high"}`
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log,
+		RulesBackend: &RulerRulesBackend{
+			URL:    server.URL + "/api/v1/rules",
+			Tenant: "tsuru",
+		},
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)}
+
+	_, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"other",
+		"rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1.api:alert",
+		"rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1.api:daily",
+		"rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1.api:medium",
+		"rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1.api:short",
+		"rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1:alert",
+	}, ruler.groupNames("tsuru-pool1"))
+	assert.Contains(t, ruler.tenants, "tsuru")
+
+	// unchanged groups are not pushed again
+	ruler.requests = nil
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, ruler.requests)
+
+	require.NoError(t, k8sClient.Get(ctx, client.ObjectKeyFromObject(instance1), instance1))
+	delete(instance1.Annotations, definition.LocationSLOsAnnotation)
+	require.NoError(t, k8sClient.Update(ctx, instance1))
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"DELETE rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1.api:alert",
+		"DELETE rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1.api:daily",
+		"DELETE rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1.api:medium",
+		"DELETE rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1.api:short",
+	}, ruler.requests)
+
+	require.NoError(t, k8sClient.Delete(ctx, instance1))
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, ruler.groupNames("tsuru-pool1"))
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// rulesNamespaceAnnotation records on the instance the namespace where its
+// rules and the other SLO outputs were written, so they are removed from there
+// once the instance maps to another namespace.
+const rulesNamespaceAnnotation = "slo.tsuru.io/rules-namespace"
+
+// outputsFinalizer holds the deletion of instances with recorded outputs
+// until they are removed from the recorded namespace, which can't be found
+// once the instance is gone.
+const outputsFinalizer = "slo.tsuru.io/outputs"
+
+type rulesNamespaceKey struct{}
+
+// withRulesNamespace makes the outputs of the instance be reconciled on the
+// given namespace instead of the one mapped from the instance namespace.
+func withRulesNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, rulesNamespaceKey{}, namespace)
+}
+
+// rulesNamespace returns the namespace where the outputs of the instance are
+// reconciled.
+func rulesNamespace(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) string {
+	if namespace, ok := ctx.Value(rulesNamespaceKey{}).(string); ok {
+		return namespace
+	}
+
+	return implicitNamespace(rpaasInstance.Namespace)
+}
+
+// recordedRulesNamespace returns the namespace where the outputs of the
+// instance were last written, or the one mapped from the instance namespace
+// when none was recorded yet.
+func recordedRulesNamespace(rpaasInstance *v1alpha1.RpaasInstance) string {
+	if namespace := rpaasInstance.Annotations[rulesNamespaceAnnotation]; namespace != "" {
+		return namespace
+	}
+
+	return implicitNamespace(rpaasInstance.Namespace)
+}
+
+// reconcilePreviousRulesNamespace removes the outputs of the instance from
+// the namespace recorded on rulesNamespaceAnnotation, when it is not the
+// current one anymore.
+func (r *RpaasInstanceReconciler) reconcilePreviousRulesNamespace(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) error {
+	previous := rpaasInstance.Annotations[rulesNamespaceAnnotation]
+	current := rulesNamespace(ctx, rpaasInstance)
+	if previous == "" || previous == current {
+		return nil
+	}
+
+	r.logger(ctx).Info("moving SLO outputs to another namespace",
+		"previousRulesNamespace", previous,
+		"rulesNamespace", current,
+	)
+
+	return r.reconcileRemovePrometheusRules(withRulesNamespace(ctx, previous), rpaasInstance)
+}
+
+// reconcileDeletedInstance removes the outputs of an instance being deleted
+// from its recorded namespace, releasing the instance afterwards.
+func (r *RpaasInstanceReconciler) reconcileDeletedInstance(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) error {
+	if !controllerutil.ContainsFinalizer(rpaasInstance, outputsFinalizer) {
+		return nil
+	}
+
+	r.recordClassMigrations(rpaasInstance, nil)
+	err := r.reconcileRemovePrometheusRules(withRulesNamespace(ctx, recordedRulesNamespace(rpaasInstance)), rpaasInstance)
+	if err != nil {
+		return err
+	}
+
+	return r.recordRulesNamespace(ctx, rpaasInstance, "")
+}
+
+// recordRulesNamespace sets rulesNamespaceAnnotation to namespace, along
+// with outputsFinalizer, removing both when empty.
+func (r *RpaasInstanceReconciler) recordRulesNamespace(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, namespace string) error {
+	if rpaasInstance.Annotations[rulesNamespaceAnnotation] == namespace &&
+		controllerutil.ContainsFinalizer(rpaasInstance, outputsFinalizer) == (namespace != "") {
+		return nil
+	}
+
+	// finalizers are replaced as a whole by merge patches
+	patch := client.MergeFromWithOptions(rpaasInstance.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	if namespace == "" {
+		delete(rpaasInstance.Annotations, rulesNamespaceAnnotation)
+		controllerutil.RemoveFinalizer(rpaasInstance, outputsFinalizer)
+	} else {
+		if rpaasInstance.Annotations == nil {
+			rpaasInstance.Annotations = map[string]string{}
+		}
+		rpaasInstance.Annotations[rulesNamespaceAnnotation] = namespace
+		controllerutil.AddFinalizer(rpaasInstance, outputsFinalizer)
+	}
+
+	err := r.Client.Patch(ctx, rpaasInstance, patch)
+	if err != nil {
+		r.logger(ctx).Error(err, "could not record the rules namespace",
+			"rulesNamespace", namespace,
+		)
+	}
+	return err
+}
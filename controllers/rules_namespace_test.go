@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileRpaasInstanceMovesRulesNamespace(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+	instance1.Annotations[rulesNamespaceAnnotation] = "tsuru-legacy"
+
+	ownedLabels := ownedObjectLabels(instance1, nil)
+	legacyRule := &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "tsuru-legacy",
+			Name:      "slos-alerts-tsuru.rpaasv2-fe-pool1.instance1",
+			Labels:    ownedLabels,
+		},
+	}
+	legacyOpenSLO := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "tsuru-legacy",
+			Name:      "openslo-tsuru.rpaasv2-fe-pool1.instance1",
+			Labels:    ownedLabels,
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1, legacyRule, legacyOpenSLO).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client:      k8sClient,
+		Log:         ctrl.Log,
+		OutputModes: []string{OutputPrometheusRules, OutputOpenSLO},
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)}
+
+	_, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyRule), &monitoringv1.PrometheusRule{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyOpenSLO), &corev1.ConfigMap{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: legacyRule.Name}, &monitoringv1.PrometheusRule{})
+	require.NoError(t, err)
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: legacyOpenSLO.Name}, &corev1.ConfigMap{})
+	require.NoError(t, err)
+
+	instance := v1alpha1.RpaasInstance{}
+	require.NoError(t, k8sClient.Get(ctx, req.NamespacedName, &instance))
+	assert.Equal(t, "tsuru-pool1", instance.Annotations[rulesNamespaceAnnotation])
+	assert.Equal(t, []string{outputsFinalizer}, instance.Finalizers)
+
+	// removing the SLO forgets the rules namespace
+	instance.Annotations[rpaasTagsAnnotation] = ""
+	require.NoError(t, k8sClient.Update(ctx, &instance))
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	require.NoError(t, k8sClient.Get(ctx, req.NamespacedName, &instance))
+	assert.NotContains(t, instance.Annotations, rulesNamespaceAnnotation)
+	assert.Empty(t, instance.Finalizers)
+}
+
+func TestReconcileRpaasInstanceDeletedFromRecordedNamespace(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+	instance1.Annotations[rulesNamespaceAnnotation] = "tsuru-legacy"
+	instance1.Finalizers = []string{outputsFinalizer}
+
+	ownedLabels := ownedObjectLabels(instance1, nil)
+	legacyRule := &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "tsuru-legacy",
+			Name:      "slos-alerts-tsuru.rpaasv2-fe-pool1.instance1",
+			Labels:    ownedLabels,
+		},
+	}
+	legacyOpenSLO := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "tsuru-legacy",
+			Name:      "openslo-tsuru.rpaasv2-fe-pool1.instance1",
+			Labels:    ownedLabels,
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1, legacyRule, legacyOpenSLO).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client:      k8sClient,
+		Log:         ctrl.Log,
+		OutputModes: []string{OutputPrometheusRules, OutputOpenSLO},
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)}
+
+	// the finalizer holds the instance, along with the recorded namespace
+	require.NoError(t, k8sClient.Delete(ctx, instance1))
+	_, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyRule), &monitoringv1.PrometheusRule{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyOpenSLO), &corev1.ConfigMap{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	err = k8sClient.Get(ctx, req.NamespacedName, &v1alpha1.RpaasInstance{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
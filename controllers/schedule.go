@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	sloKubernetes "github.com/globocom/slo-generator/kubernetes"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// scheduleResyncPeriod is the longest period before the rules of scheduled
+// SLOs are generated again, picking up time zone offset changes.
+const scheduleResyncPeriod = 24 * time.Hour
+
+var now = time.Now
+
+// scheduledPrometheusRules generates the rules of every class of the
+// schedule, merged into the same PrometheusRules. The alerts of each class
+// are gated by the time windows where the class is in force, since
+// Prometheus evaluates time functions in UTC the current offset of the
+// schedule time zone is used.
+func (s *InstanceSLO) scheduledPrometheusRules() []monitoringv1.PrometheusRule {
+	_, offset := now().In(s.Schedule.Location).Zone()
+
+	var windowConditions []string
+	for _, window := range s.Schedule.Windows {
+		windowConditions = append(windowConditions, scheduleWindowCondition(window, offset))
+	}
+
+	rules := sloKubernetes.GenerateManifests(sloKubernetes.Opts{
+		SLO:   s.SLO,
+		Class: s.Class,
+	})
+	// "or" binds looser than "unless", the union of the windows is wrapped
+	gateAlerts(rules, "unless on() (("+strings.Join(windowConditions, ") or (")+"))")
+
+	for i, window := range s.Schedule.Windows {
+		windowSLO := s.SLO
+		windowSLO.Class = window.Class.Name
+		windowSLO.Labels = map[string]string{}
+		for key, value := range s.SLO.Labels {
+			windowSLO.Labels[key] = value
+		}
+		windowSLO.Labels["slo_class"] = window.Class.Name
+
+		windowRules := sloKubernetes.GenerateManifests(sloKubernetes.Opts{
+			SLO:   windowSLO,
+			Class: window.Class,
+		})
+		gateAlerts(windowRules, "and on() ("+windowConditions[i]+")")
+		rules = mergePrometheusRules(rules, windowRules)
+	}
+
+	return rules
+}
+
+// scheduleWindowCondition returns a PromQL expression with a single series
+// only while the window is in force, eg:
+// (day_of_week(vector(time() + -10800)) == 6 or day_of_week(vector(time() + -10800)) == 0) and on() (hour(vector(time() + -10800)) >= 9 < 18)
+func scheduleWindowCondition(window definition.ScheduleWindow, offset int) string {
+	localTime := fmt.Sprintf("vector(time() + %d)", offset)
+
+	var conditions []string
+	if len(window.Days) > 0 && len(window.Days) < 7 {
+		var days []string
+		for _, day := range window.Days {
+			days = append(days, fmt.Sprintf("day_of_week(%s) == %d", localTime, day))
+		}
+		conditions = append(conditions, "("+strings.Join(days, " or ")+")")
+	}
+
+	switch {
+	case window.StartHour == 0 && window.EndHour == 24:
+	case window.StartHour < window.EndHour:
+		conditions = append(conditions, fmt.Sprintf("(hour(%s) >= %d < %d)", localTime, window.StartHour, window.EndHour))
+	default:
+		conditions = append(conditions, fmt.Sprintf("(hour(%s) >= %d or hour(%s) < %d)", localTime, window.StartHour, localTime, window.EndHour))
+	}
+
+	if len(conditions) == 0 {
+		return "vector(1)"
+	}
+
+	return strings.Join(conditions, " and on() ")
+}
+
+func gateAlerts(rules []monitoringv1.PrometheusRule, condition string) {
+	for i := range rules {
+		for j := range rules[i].Spec.Groups {
+			for k, rule := range rules[i].Spec.Groups[j].Rules {
+				if rule.Alert == "" {
+					continue
+				}
+				rules[i].Spec.Groups[j].Rules[k].Expr = intstr.FromString("(" + rule.Expr.String() + ") " + condition)
+			}
+		}
+	}
+}
+
+// mergePrometheusRules appends the rules of the groups from src into the
+// groups with the same name on the PrometheusRules with the same name in dst.
+func mergePrometheusRules(dst, src []monitoringv1.PrometheusRule) []monitoringv1.PrometheusRule {
+	for _, srcRule := range src {
+		i := findPrometheusRule(dst, srcRule.Name)
+		if i < 0 {
+			dst = append(dst, srcRule)
+			continue
+		}
+
+		for _, srcGroup := range srcRule.Spec.Groups {
+			merged := false
+			for j := range dst[i].Spec.Groups {
+				if dst[i].Spec.Groups[j].Name == srcGroup.Name {
+					dst[i].Spec.Groups[j].Rules = append(dst[i].Spec.Groups[j].Rules, srcGroup.Rules...)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				dst[i].Spec.Groups = append(dst[i].Spec.Groups, srcGroup)
+			}
+		}
+	}
+
+	return dst
+}
+
+func findPrometheusRule(rules []monitoringv1.PrometheusRule, name string) int {
+	for i := range rules {
+		if rules[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// scheduleRequeueAfter returns when the rules of scheduled SLOs must be
+// generated again: within an hour after the next time zone offset change or
+// after scheduleResyncPeriod. Zero is returned when no SLO is scheduled.
+func scheduleRequeueAfter(slos []InstanceSLO) time.Duration {
+	var result time.Duration
+	current := now()
+	for _, s := range slos {
+		if s.Schedule == nil {
+			continue
+		}
+
+		requeueAfter := scheduleResyncPeriod
+		_, offset := current.In(s.Schedule.Location).Zone()
+		for d := time.Hour; d < scheduleResyncPeriod; d += time.Hour {
+			if _, next := current.Add(d).In(s.Schedule.Location).Zone(); next != offset {
+				requeueAfter = d
+				break
+			}
+		}
+
+		if result == 0 || requeueAfter < result {
+			result = requeueAfter
+		}
+	}
+
+	return result
+}
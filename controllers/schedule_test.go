@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileRpaasInstanceScheduledSLO(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC) }
+
+	ctx := context.TODO()
+	rpaasInstance1 := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Labels: map[string]string{
+				rpaasTeamOwnerAnnotation:    "my-team",
+				rpaasInstanceNameAnnotation: "instance1",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+			},
+			Annotations: map[string]string{
+				rpaasTagsAnnotation:           "slo:medium",
+				definition.ScheduleAnnotation: `{"timezone": "America/Sao_Paulo", "windows": [{"days": ["mon-fri"], "hours": "9-18", "class": "critical"}]}`,
+			},
+		},
+	}
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(rpaasInstance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log,
+	}
+
+	result, err := reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "instance1",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, result.RequeueAfter)
+
+	prometheusRule := monitoringv1.PrometheusRule{}
+	err = k8sClient.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "slos-alerts-tsuru.default.instance1",
+	}, &prometheusRule)
+	require.NoError(t, err)
+	require.Len(t, prometheusRule.Spec.Groups, 1)
+
+	window := "(day_of_week(vector(time() + -10800)) == 1 or day_of_week(vector(time() + -10800)) == 2 or day_of_week(vector(time() + -10800)) == 3 or day_of_week(vector(time() + -10800)) == 4 or day_of_week(vector(time() + -10800)) == 5) and on() (hour(vector(time() + -10800)) >= 9 < 18)"
+
+	classes := map[string]int{}
+	for _, rule := range prometheusRule.Spec.Groups[0].Rules {
+		class := rule.Labels["slo_class"]
+		classes[class]++
+
+		expr := rule.Expr.String()
+		switch class {
+		case "medium":
+			assert.True(t, strings.HasSuffix(expr, ") unless on() (("+window+"))"), expr)
+		case "critical":
+			assert.True(t, strings.HasSuffix(expr, ") and on() ("+window+")"), expr)
+		default:
+			t.Errorf("unexpected class %q", class)
+		}
+	}
+	assert.Equal(t, 2, classes["medium"])
+	assert.Equal(t, 4, classes["critical"])
+}
+
+func TestScheduledPrometheusRulesWindowsUnion(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC) }
+
+	rpaasInstance := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Annotations: map[string]string{
+				rpaasTagsAnnotation:           "slo:medium",
+				definition.ScheduleAnnotation: `{"timezone": "UTC", "windows": [{"days": ["mon-fri"], "hours": "9-18", "class": "critical"}, {"days": ["sat"], "class": "high"}]}`,
+			},
+		},
+	}
+
+	slos, err := InstanceSLOs(rpaasInstance, nil)
+	require.NoError(t, err)
+	require.Len(t, slos, 1)
+
+	weekdays := "(day_of_week(vector(time() + 0)) == 1 or day_of_week(vector(time() + 0)) == 2 or day_of_week(vector(time() + 0)) == 3 or day_of_week(vector(time() + 0)) == 4 or day_of_week(vector(time() + 0)) == 5) and on() (hour(vector(time() + 0)) >= 9 < 18)"
+	saturday := "(day_of_week(vector(time() + 0)) == 6)"
+
+	alerts := 0
+	for _, prometheusRule := range slos[0].PrometheusRules() {
+		for _, group := range prometheusRule.Spec.Groups {
+			for _, rule := range group.Rules {
+				expr, err := parser.ParseExpr(rule.Expr.String())
+				require.NoError(t, err, rule.Expr.String())
+				if rule.Alert == "" || rule.Labels["slo_class"] != "medium" {
+					continue
+				}
+				alerts++
+
+				// the alert is gated by the union of the windows as a whole
+				binary, ok := expr.(*parser.BinaryExpr)
+				require.True(t, ok, rule.Expr.String())
+				assert.Equal(t, parser.ItemType(parser.LUNLESS), binary.Op)
+				assert.Equal(t, "(("+weekdays+") or ("+saturday+"))", binary.RHS.String())
+			}
+		}
+	}
+	assert.Equal(t, 2, alerts)
+}
+
+func TestScheduleWindowCondition(t *testing.T) {
+	assert.Equal(t, "vector(1)", scheduleWindowCondition(definition.ScheduleWindow{StartHour: 0, EndHour: 24}, 0))
+	assert.Equal(t, "(hour(vector(time() + 3600)) >= 22 or hour(vector(time() + 3600)) < 6)", scheduleWindowCondition(definition.ScheduleWindow{StartHour: 22, EndHour: 6}, 3600))
+	assert.Equal(t, "(day_of_week(vector(time() + 0)) == 6 or day_of_week(vector(time() + 0)) == 0)", scheduleWindowCondition(definition.ScheduleWindow{
+		Days:      []time.Weekday{time.Saturday, time.Sunday},
+		StartHour: 0,
+		EndHour:   24,
+	}, 0))
+}
+
+func TestScheduleRequeueAfter(t *testing.T) {
+	defer func() { now = time.Now }()
+	// Europe/Berlin switches from CEST to CET at 2021-10-31 01:00 UTC
+	now = func() time.Time { return time.Date(2021, 10, 30, 20, 30, 0, 0, time.UTC) }
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Duration(0), scheduleRequeueAfter([]InstanceSLO{{}}))
+	assert.Equal(t, 5*time.Hour, scheduleRequeueAfter([]InstanceSLO{
+		{Schedule: &definition.Schedule{Location: time.UTC}},
+		{Schedule: &definition.Schedule{Location: berlin}},
+	}))
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// CacheNamespaces returns the namespaces to be cached by a manager watching
+// RpaasInstances only on the given namespaces, including the namespaces
+// where their rules live.
+func CacheNamespaces(namespaces []string) []string {
+	set := map[string]bool{}
+	for _, namespace := range namespaces {
+		set[namespace] = true
+		set[implicitNamespace(namespace)] = true
+	}
+
+	result := make([]string, 0, len(set))
+	for namespace := range set {
+		result = append(result, namespace)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// selected returns whether the object matches the selector, a nil selector
+// matches everything.
+func selected(selector labels.Selector, obj client.Object) bool {
+	return selector == nil || selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// instanceSelectorPredicate filters out the events of RpaasInstances out of
+// the selector. Updates are kept when either the old or the new object
+// matches, so instances leaving the selector get their outputs removed.
+func instanceSelectorPredicate(selector labels.Selector) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return selected(selector, e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return selected(selector, e.ObjectOld) || selected(selector, e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return selected(selector, e.Object)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return selected(selector, e.Object)
+		},
+	}
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestCacheNamespaces(t *testing.T) {
+	assert.Equal(t, []string{"default", "rpaasv2-be-pool1", "rpaasv2-fe-pool1", "tsuru-pool1"}, CacheNamespaces([]string{"rpaasv2-fe-pool1", "rpaasv2-be-pool1", "default"}))
+}
+
+func TestInstanceSelectorPredicate(t *testing.T) {
+	selector, err := labels.Parse("environment=prod")
+	require.NoError(t, err)
+
+	prod := &v1alpha1.RpaasInstance{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"environment": "prod"}}}
+	dev := &v1alpha1.RpaasInstance{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"environment": "dev"}}}
+
+	p := instanceSelectorPredicate(selector)
+	assert.True(t, p.Create(event.CreateEvent{Object: prod}))
+	assert.False(t, p.Create(event.CreateEvent{Object: dev}))
+	assert.True(t, p.Update(event.UpdateEvent{ObjectOld: prod, ObjectNew: dev}))
+	assert.False(t, p.Update(event.UpdateEvent{ObjectOld: dev, ObjectNew: dev}))
+	assert.False(t, p.Delete(event.DeleteEvent{Object: dev}))
+
+	assert.True(t, instanceSelectorPredicate(nil).Create(event.CreateEvent{Object: dev}))
+}
+
+func TestReconcileRpaasInstanceOutOfSelector(t *testing.T) {
+	ctx := context.TODO()
+	rpaasInstance1 := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "instance1",
+			Labels: map[string]string{
+				rpaasInstanceNameAnnotation: "instance1",
+				rpaasServiceNameAnnotation:  "rpaasv2",
+				"environment":               "prod",
+			},
+			Annotations: map[string]string{
+				rpaasTagsAnnotation: "slo:critical",
+			},
+		},
+	}
+
+	selector, err := labels.Parse("environment=prod")
+	require.NoError(t, err)
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(rpaasInstance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		InstanceSelector: selector,
+		Client:           k8sClient,
+		Log:              ctrl.Log,
+	}
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "instance1",
+		},
+	}
+	_, err = reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	prometheusRules := monitoringv1.PrometheusRuleList{}
+	err = k8sClient.List(ctx, &prometheusRules, client.InNamespace("default"))
+	require.NoError(t, err)
+	assert.Len(t, prometheusRules.Items, 1)
+
+	require.NoError(t, k8sClient.Get(ctx, client.ObjectKeyFromObject(rpaasInstance1), rpaasInstance1))
+	rpaasInstance1.Labels["environment"] = "dev"
+	err = k8sClient.Update(ctx, rpaasInstance1)
+	require.NoError(t, err)
+
+	_, err = reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	err = k8sClient.List(ctx, &prometheusRules, client.InNamespace("default"))
+	require.NoError(t, err)
+	assert.Empty(t, prometheusRules.Items)
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// rulesShardLabel identifies the PrometheusRules holding the rule groups
+	// of several instances.
+	rulesShardLabel = "slo.tsuru.io/rules-shard"
+
+	rulesShardPrefix = "slos-shard-"
+)
+
+type rulesShard struct {
+	index  int
+	rule   *monitoringv1.PrometheusRule
+	groups []monitoringv1.RuleGroup
+}
+
+// reconcileRulesShards moves the rule groups of the instance into the
+// PrometheusRule shards of its rules namespace. The groups of an instance
+// are kept together on the first of its candidate shards with room, see
+// rulesShardCandidate, so the shard of an instance only depends on its
+// namespace and name and on the room left on its candidates. Shards left
+// without groups are removed. Passing no rules removes the groups of the
+// instance from every shard.
+func (r *RpaasInstanceReconciler) reconcileRulesShards(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, prometheusRules []monitoringv1.PrometheusRule) error {
+	log := r.logger(ctx)
+
+	namespace := rulesNamespace(ctx, rpaasInstance)
+	prefix := instanceGroupPrefix(rpaasInstance)
+
+	list := monitoringv1.PrometheusRuleList{}
+	err := r.Client.List(ctx, &list, client.InNamespace(namespace), client.MatchingLabels{rulesShardLabel: "true"})
+	if err != nil {
+		log.Error(err, "could not list PrometheusRule shards",
+			"rulesNamespace", namespace,
+		)
+		return err
+	}
+
+	var shards []*rulesShard
+	for _, rule := range list.Items {
+		index, err := strconv.Atoi(strings.TrimPrefix(rule.Name, rulesShardPrefix))
+		if err != nil {
+			continue
+		}
+
+		shard := &rulesShard{index: index, rule: rule}
+		for _, group := range rule.Spec.Groups {
+			if strings.HasPrefix(group.Name, prefix) {
+				continue
+			}
+			shard.groups = append(shard.groups, group)
+		}
+		shards = append(shards, shard)
+	}
+
+	sort.Slice(shards, func(i, j int) bool {
+		return shards[i].index < shards[j].index
+	})
+
+	groups := instanceRuleGroups(rpaasInstance, prometheusRules)
+
+	var placed *rulesShard
+	if len(groups) > 0 {
+		placed = r.placeRulesShard(shards, prefix, rulesGroupsSize(groups))
+		if placed.rule == nil {
+			shards = append(shards, placed)
+		}
+		placed.groups = append(placed.groups, groups...)
+	}
+
+	for _, shard := range shards {
+		err = r.writeRulesShard(ctx, rpaasInstance, namespace, shard)
+		if err != nil {
+			return err
+		}
+	}
+
+	if placed != nil {
+		r.warnUnselectedRules(ctx, rpaasInstance, placed.rule)
+	}
+
+	return nil
+}
+
+// placeRulesShard returns the first candidate shard of the instance fitting
+// groups of the given size, which is a new shard when the candidate does not
+// exist yet. Empty shards fit groups of any size, so the probing always ends.
+func (r *RpaasInstanceReconciler) placeRulesShard(shards []*rulesShard, key string, size int) *rulesShard {
+	byIndex := map[int]*rulesShard{}
+	for _, shard := range shards {
+		byIndex[shard.index] = shard
+	}
+
+	for attempt := 0; ; attempt++ {
+		index := rulesShardCandidate(key, attempt)
+		shard, ok := byIndex[index]
+		if !ok {
+			return &rulesShard{index: index}
+		}
+		if len(shard.groups) == 0 || rulesGroupsSize(shard.groups)+size <= r.RulesShardMaxSize {
+			return shard
+		}
+	}
+}
+
+// rulesShardCandidate returns the index of the shard tried on the given
+// attempt to place the groups of an instance. Shards are arranged in levels
+// doubling in size, shard 0 alone, then shards 1 and 2, then 3 to 6 and so
+// on, and each attempt hashes the key onto a shard of the next level. A few
+// instances share shard 0, and the shards only grow as needed.
+func rulesShardCandidate(key string, attempt int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	level := 1 << attempt
+	return level - 1 + int(h.Sum32()%uint32(level))
+}
+
+func (r *RpaasInstanceReconciler) writeRulesShard(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, namespace string, shard *rulesShard) error {
+	log := r.logger(ctx)
+
+	sort.Slice(shard.groups, func(i, j int) bool {
+		return shard.groups[i].Name < shard.groups[j].Name
+	})
+
+	labels := r.rulesShardLabels(rpaasInstance)
+
+	if shard.rule == nil {
+		prometheusRule := &monitoringv1.PrometheusRule{}
+		prometheusRule.Name = rulesShardPrefix + strconv.Itoa(shard.index)
+		prometheusRule.Namespace = namespace
+		prometheusRule.Labels = labels
+		prometheusRule.Spec.Groups = shard.groups
+		shard.rule = prometheusRule
+
+		spanCtx, span := r.startRuleSpan(ctx, "CreatePrometheusRule", prometheusRule)
+		err := r.Client.Create(spanCtx, prometheusRule)
+		endSpan(span, err)
+		if err != nil {
+			log.Error(err, "could not create PrometheusRule shard",
+				"rule", prometheusRule.Name,
+				"rulesNamespace", namespace,
+			)
+			return err
+		}
+
+		log.Info("created PrometheusRule shard",
+			"rule", prometheusRule.Name,
+			"rulesNamespace", namespace)
+		return nil
+	}
+
+	if len(shard.groups) == 0 {
+		// the shard may have received groups of other instances since it was
+		// listed, those must not be removed along with it
+		spanCtx, span := r.startRuleSpan(ctx, "DeletePrometheusRule", shard.rule)
+		err := r.Client.Delete(spanCtx, shard.rule, client.Preconditions{ResourceVersion: &shard.rule.ResourceVersion})
+		endSpan(span, err)
+		if err != nil {
+			log.Error(err, "could not remove empty PrometheusRule shard",
+				"rule", shard.rule.Name,
+				"rulesNamespace", namespace,
+			)
+			return err
+		}
+		return nil
+	}
+
+	if reflect.DeepEqual(shard.rule.Spec.Groups, shard.groups) && reflect.DeepEqual(shard.rule.Labels, labels) {
+		return nil
+	}
+
+	shard.rule.Labels = labels
+	shard.rule.Spec.Groups = shard.groups
+	spanCtx, span := r.startRuleSpan(ctx, "UpdatePrometheusRule", shard.rule)
+	err := r.Client.Update(spanCtx, shard.rule)
+	endSpan(span, err)
+	if err != nil {
+		log.Error(err, "could not update PrometheusRule shard",
+			"rule", shard.rule.Name,
+			"rulesNamespace", namespace,
+		)
+		return err
+	}
+
+	return nil
+}
+
+// instanceGroupPrefix identifies the rule groups of an instance when stored
+// along with the groups of other instances, since slashes are not allowed on
+// names it never matches groups of other instances.
+func instanceGroupPrefix(rpaasInstance *v1alpha1.RpaasInstance) string {
+	return fmt.Sprintf("%s/%s/", rpaasInstance.Namespace, rpaasInstance.Name)
+}
+
+// instanceRuleGroups returns the groups of the PrometheusRules, named with
+// the prefix of the instance.
+func instanceRuleGroups(rpaasInstance *v1alpha1.RpaasInstance, prometheusRules []monitoringv1.PrometheusRule) []monitoringv1.RuleGroup {
+	prefix := instanceGroupPrefix(rpaasInstance)
+
+	var groups []monitoringv1.RuleGroup
+	for _, prometheusRule := range prometheusRules {
+		for _, group := range prometheusRule.Spec.Groups {
+			group.Name = prefix + group.Name
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+func (r *RpaasInstanceReconciler) rulesShardLabels(rpaasInstance *v1alpha1.RpaasInstance) map[string]string {
+	labels := r.ruleLabels(rpaasInstance, "")
+	labels[rulesShardLabel] = "true"
+	if instancePool := implicitPool(rpaasInstance.Namespace); instancePool != "" {
+		labels[tsuruPoolLabel] = instancePool
+	}
+	return labels
+}
+
+// rulesGroupsSize approximates the size taken by the groups on the rule files
+// generated by the Prometheus operator.
+func rulesGroupsSize(groups []monitoringv1.RuleGroup) int {
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
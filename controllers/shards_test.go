@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newShardedInstance(name string) *v1alpha1.RpaasInstance {
+	return &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "rpaasv2-fe-pool1",
+			Name:      name,
+			Labels: map[string]string{
+				rpaasInstanceNameAnnotation: name,
+				rpaasServiceNameAnnotation:  "rpaasv2",
+			},
+			Annotations: map[string]string{
+				rpaasTagsAnnotation: "slo:critical",
+			},
+		},
+	}
+}
+
+func shardGroupNames(t *testing.T, k8sClient client.Client, name string) []string {
+	prometheusRule := monitoringv1.PrometheusRule{}
+	err := k8sClient.Get(context.TODO(), client.ObjectKey{Namespace: "tsuru-pool1", Name: name}, &prometheusRule)
+	require.NoError(t, err)
+
+	var names []string
+	for _, group := range prometheusRule.Spec.Groups {
+		names = append(names, group.Name)
+	}
+	return names
+}
+
+func TestReconcileRpaasInstanceRulesShards(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+	instance2 := newShardedInstance("instance2")
+	instance3 := newShardedInstance("instance3")
+
+	slos, err := InstanceSLOs(instance1, nil)
+	require.NoError(t, err)
+	groupSize := rulesGroupsSize(slos[0].PrometheusRules()[0].Spec.Groups)
+	require.NotZero(t, groupSize)
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1, instance2, instance3).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log,
+		// room for two instances on each shard
+		RulesShardMaxSize: 2*groupSize + 100,
+	}
+
+	for _, instance := range []*v1alpha1.RpaasInstance{instance1, instance2, instance3} {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{
+		"rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1:alert",
+		"rpaasv2-fe-pool1/instance2/slo:tsuru.rpaasv2-fe-pool1.instance2:alert",
+	}, shardGroupNames(t, k8sClient, "slos-shard-0"))
+	assert.Equal(t, []string{
+		"rpaasv2-fe-pool1/instance3/slo:tsuru.rpaasv2-fe-pool1.instance3:alert",
+	}, shardGroupNames(t, k8sClient, "slos-shard-1"))
+
+	shard := monitoringv1.PrometheusRule{}
+	require.NoError(t, k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slos-shard-0"}, &shard))
+	assert.Equal(t, map[string]string{rulesShardLabel: "true", tsuruPoolLabel: "pool1"}, shard.Labels)
+
+	list := monitoringv1.PrometheusRuleList{}
+	require.NoError(t, k8sClient.List(ctx, &list))
+	assert.Len(t, list.Items, 2)
+
+	// reconciling again keeps the placement
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance2)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"rpaasv2-fe-pool1/instance1/slo:tsuru.rpaasv2-fe-pool1.instance1:alert",
+		"rpaasv2-fe-pool1/instance2/slo:tsuru.rpaasv2-fe-pool1.instance2:alert",
+	}, shardGroupNames(t, k8sClient, "slos-shard-0"))
+
+	require.NoError(t, k8sClient.Delete(ctx, instance1))
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"rpaasv2-fe-pool1/instance2/slo:tsuru.rpaasv2-fe-pool1.instance2:alert",
+	}, shardGroupNames(t, k8sClient, "slos-shard-0"))
+	assert.Equal(t, []string{
+		"rpaasv2-fe-pool1/instance3/slo:tsuru.rpaasv2-fe-pool1.instance3:alert",
+	}, shardGroupNames(t, k8sClient, "slos-shard-1"))
+
+	require.NoError(t, k8sClient.Delete(ctx, instance3))
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance3)})
+	require.NoError(t, err)
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slos-shard-1"}, &monitoringv1.PrometheusRule{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+func TestReconcileRpaasInstanceRulesShardsCandidates(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+	instance2 := newShardedInstance("instance2")
+	instance3 := newShardedInstance("instance3")
+	instance4 := newShardedInstance("instance4")
+
+	slos, err := InstanceSLOs(instance1, nil)
+	require.NoError(t, err)
+	groupSize := rulesGroupsSize(slos[0].PrometheusRules()[0].Spec.Groups)
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1, instance2, instance3, instance4).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client:            k8sClient,
+		Log:               ctrl.Log,
+		RulesShardMaxSize: 2*groupSize + 100,
+	}
+
+	for _, instance := range []*v1alpha1.RpaasInstance{instance1, instance2, instance3, instance4} {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)})
+		require.NoError(t, err)
+	}
+
+	// instance3 and instance4 are hashed onto different shards of the
+	// second level, rather than packed on the lowest free one
+	assert.Equal(t, 1, rulesShardCandidate(instanceGroupPrefix(instance3), 1))
+	assert.Equal(t, 2, rulesShardCandidate(instanceGroupPrefix(instance4), 1))
+	assert.Equal(t, []string{
+		"rpaasv2-fe-pool1/instance3/slo:tsuru.rpaasv2-fe-pool1.instance3:alert",
+	}, shardGroupNames(t, k8sClient, "slos-shard-1"))
+	assert.Equal(t, []string{
+		"rpaasv2-fe-pool1/instance4/slo:tsuru.rpaasv2-fe-pool1.instance4:alert",
+	}, shardGroupNames(t, k8sClient, "slos-shard-2"))
+
+	// groups go back to the first candidate once it has room
+	require.NoError(t, k8sClient.Delete(ctx, instance1))
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)})
+	require.NoError(t, err)
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance4)})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"rpaasv2-fe-pool1/instance2/slo:tsuru.rpaasv2-fe-pool1.instance2:alert",
+		"rpaasv2-fe-pool1/instance4/slo:tsuru.rpaasv2-fe-pool1.instance4:alert",
+	}, shardGroupNames(t, k8sClient, "slos-shard-0"))
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slos-shard-2"}, &monitoringv1.PrometheusRule{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+// preconditionsRecorder records the preconditions of the deletions.
+type preconditionsRecorder struct {
+	client.Client
+	preconditions map[string]*metav1.Preconditions
+}
+
+func (c *preconditionsRecorder) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	options := client.DeleteOptions{}
+	options.ApplyOptions(opts)
+	c.preconditions[obj.GetName()] = options.Preconditions
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestReconcileRpaasInstanceRulesShardsDeletePreconditions(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+
+	k8sClient := &preconditionsRecorder{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithRuntimeObjects(instance1).Build(),
+		preconditions: map[string]*metav1.Preconditions{},
+	}
+	reconciler := &RpaasInstanceReconciler{
+		Client:            k8sClient,
+		Log:               ctrl.Log,
+		RulesShardMaxSize: 1024 * 1024,
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)}
+
+	_, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	shard := monitoringv1.PrometheusRule{}
+	require.NoError(t, k8sClient.Get(ctx, client.ObjectKey{Namespace: "tsuru-pool1", Name: "slos-shard-0"}, &shard))
+
+	require.NoError(t, k8sClient.Delete(ctx, instance1))
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	require.NotNil(t, k8sClient.preconditions["slos-shard-0"])
+	require.NotNil(t, k8sClient.preconditions["slos-shard-0"].ResourceVersion)
+	assert.Equal(t, shard.ResourceVersion, *k8sClient.preconditions["slos-shard-0"].ResourceVersion)
+}
+
+func TestReconcileRpaasInstanceRulesShardsToggle(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+	instance1.Labels[rpaasTeamOwnerAnnotation] = "my-team"
+
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(instance1).Build()
+	reconciler := &RpaasInstanceReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log,
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)}
+
+	_, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	reconciler.RulesShardMaxSize = 1024 * 1024
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	list := monitoringv1.PrometheusRuleList{}
+	require.NoError(t, k8sClient.List(ctx, &list))
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "slos-shard-0", list.Items[0].Name)
+
+	reconciler.RulesShardMaxSize = 0
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	list = monitoringv1.PrometheusRuleList{}
+	require.NoError(t, k8sClient.List(ctx, &list))
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "slos-alerts-tsuru.rpaasv2-fe-pool1.instance1", list.Items[0].Name)
+}
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sloKubernetes "github.com/globocom/slo-generator/kubernetes"
+	"github.com/globocom/slo-generator/slo"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// InstanceSLO is a SLO generated for a RpaasInstance (or for one of its
+// locations or virtual hosts) along with its class.
+type InstanceSLO struct {
+	SLO   slo.SLO
+	Class *slo.Class
+
+	// Schedule holds the classes in force on time windows, Class is in force
+	// out of them. Only the PrometheusRules honor the schedule.
+	Schedule *definition.Schedule
+
+	// DeprecatedClasses are the classes replaced on the SLO, or on its
+	// schedule, when migrated from deprecated classes.
+	DeprecatedClasses []*slo.Class
+
+	latencyHistogram, latencyMatchers string
+}
+
+// PrometheusRules generates the PrometheusRules of the SLO, without the
+// metadata set by the reconciler.
+func (s *InstanceSLO) PrometheusRules() []monitoringv1.PrometheusRule {
+	if s.Schedule != nil {
+		return s.scheduledPrometheusRules()
+	}
+
+	return sloKubernetes.GenerateManifests(sloKubernetes.Opts{
+		SLO:   s.SLO,
+		Class: s.Class,
+	})
+}
+
+// InstanceSLOs returns every SLO declared for a RpaasInstance, SLOs with
+// invalid classes are skipped and reported on the returned error.
+func InstanceSLOs(rpaasInstance *v1alpha1.RpaasInstance, annotations map[string]string) ([]InstanceSLO, error) {
+	var errs []error
+	instancePool := implicitPool(rpaasInstance.Namespace)
+	sloName := InstanceSLOName(rpaasInstance)
+
+	var result []InstanceSLO
+	sloClass, _ := definition.SLOClass(rpaasInstance)
+	if sloClass != nil {
+		schedule, err := definition.SLOSchedule(rpaasInstance)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		instanceSLO := newInstanceSLO(sloName, sloClass, sloRulesLabels(rpaasInstance, sloClass, instancePool), annotations)
+		instanceSLO.Schedule = schedule
+		instanceSLO.latencyHistogram, instanceSLO.latencyMatchers = InstanceLatencyHistogram(rpaasInstance)
+		result = append(result, instanceSLO)
+	}
+
+	locationClasses, err := definition.LocationSLOClasses(rpaasInstance)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	slugs := map[string]string{}
+	for _, location := range rpaasInstance.Spec.Locations {
+		locationClass := locationClasses[location.Path]
+		if locationClass == nil {
+			continue
+		}
+
+		slug := locationSlug(location.Path)
+		if slugs[slug] != "" {
+			errs = append(errs, fmt.Errorf("location %q conflicts with location %q", location.Path, slugs[slug]))
+			continue
+		}
+		slugs[slug] = location.Path
+
+		locationLabels := sloRulesLabels(rpaasInstance, locationClass, instancePool)
+		locationLabels["rpaas_location"] = location.Path
+		locationSLO := newInstanceSLO(sloName+"."+slug, locationClass, locationLabels, annotations)
+		locationSLO.setSLIRecords(vtsFilterRequestsMetric, vtsFilterDurationMetric, "direction",
+			instanceMatchers(rpaasInstance)+fmt.Sprintf(`,filter=%q,filter_name=%q`, vtsLocationFilter, location.Path))
+		result = append(result, locationSLO)
+	}
+
+	hostClasses, err := definition.HostSLOClasses(rpaasInstance)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	hosts := make([]string, 0, len(hostClasses))
+	for host := range hostClasses {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		hostLabels := sloRulesLabels(rpaasInstance, hostClasses[host], instancePool)
+		hostLabels["rpaas_host"] = host
+		hostSLO := newInstanceSLO(sloName+".host."+host, hostClasses[host], hostLabels, annotations)
+		hostSLO.setSLIRecords(vtsServerRequestsMetric, vtsServerDurationMetric, "code",
+			instanceMatchers(rpaasInstance)+fmt.Sprintf(`,host=%q`, host))
+		result = append(result, hostSLO)
+	}
+
+	return result, utilerrors.NewAggregate(errs)
+}
+
+// InstanceSLOName returns the name of the instance-wide SLO, which is also
+// the service label of its SLIs.
+func InstanceSLOName(rpaasInstance *v1alpha1.RpaasInstance) string {
+	return sloName(rpaasInstance.Namespace, rpaasInstance.Name)
+}
+
+func sloName(namespace, name string) string {
+	return "tsuru." + namespace + "." + name
+}
+
+// RulesNamespace returns the namespace where the rules of instances from the
+// given namespace are created.
+func RulesNamespace(namespace string) string {
+	return implicitNamespace(namespace)
+}
+
+// InstancePool returns the tsuru pool of instances from the given namespace,
+// if any.
+func InstancePool(namespace string) string {
+	return implicitPool(namespace)
+}
+
+// TeamOwner returns the tsuru team that owns the instance.
+func TeamOwner(rpaasInstance *v1alpha1.RpaasInstance) string {
+	if team := rpaasInstance.Labels[rpaasTeamOwnerAnnotation]; team != "" {
+		return team
+	}
+
+	return rpaasInstance.Annotations[rpaasTeamOwnerAnnotation]
+}
+
+// ServiceName returns the rpaas service of the instance.
+func ServiceName(rpaasInstance *v1alpha1.RpaasInstance) string {
+	return rpaasInstance.Labels[rpaasServiceNameAnnotation]
+}
+
+// Owner identifies the RpaasInstance an object was generated for, as found
+// on the labels of the object.
+type Owner struct {
+	Service  string
+	Instance string
+	Team     string
+	Pool     string
+	// Namespace is the namespace of the instance, empty for objects
+	// generated before it was labeled.
+	Namespace string
+}
+
+// ObjectOwner returns the owner of an object generated for a RpaasInstance.
+func ObjectOwner(obj metav1.Object) Owner {
+	objLabels := obj.GetLabels()
+	return Owner{
+		Service:   objLabels[rpaasServiceNameAnnotation],
+		Instance:  objLabels[rpaasInstanceNameAnnotation],
+		Team:      objLabels[rpaasTeamOwnerAnnotation],
+		Pool:      objLabels[tsuruPoolLabel],
+		Namespace: objLabels[instanceNamespaceLabel],
+	}
+}
+
+// OwnedObjectsSelector selects the objects generated for any RpaasInstance.
+func OwnedObjectsSelector() client.MatchingLabelsSelector {
+	requirement, _ := labels.NewRequirement(rpaasInstanceNameAnnotation, selection.Exists, nil)
+	return client.MatchingLabelsSelector{Selector: labels.NewSelector().Add(*requirement)}
+}
+
+func newInstanceSLO(name string, sloClass *slo.Class, labels, annotations map[string]string) InstanceSLO {
+	return InstanceSLO{
+		SLO: slo.SLO{
+			Name:        name,
+			Class:       sloClass.Name,
+			Labels:      labels,
+			Annotations: annotations,
+			LatencyRecord: slo.ExprBlock{
+				AlertMethod: "multi-window",
+			},
+			ErrorRateRecord: slo.ExprBlock{
+				AlertMethod: "multi-window",
+			},
+		},
+		Class: sloClass,
+	}
+}
+
+// Metrics of the nginx VTS module, whose series are expected to carry the
+// namespace and the name of the instance on the namespace and rpaas_instance
+// labels. Hosts are measured by the server zones named after them, the whole
+// instance by the "*" server zone and locations are only measured with the
+// filter:
+// vhost_traffic_status_filter_by_set_key <location path> location;
+const (
+	vtsServerRequestsMetric = "nginx_vts_server_requests_total"
+	vtsServerDurationMetric = "nginx_vts_server_request_duration_seconds"
+	vtsFilterRequestsMetric = "nginx_vts_filter_requests_total"
+	vtsFilterDurationMetric = "nginx_vts_filter_request_duration_seconds"
+	vtsLocationFilter       = "location"
+	vtsAllServerZones       = "*"
+)
+
+func instanceMatchers(rpaasInstance *v1alpha1.RpaasInstance) string {
+	return fmt.Sprintf(`namespace=%q,rpaas_instance=%q`, rpaasInstance.Namespace, rpaasInstance.Name)
+}
+
+// InstanceLatencyHistogram returns the name and the label matchers of the
+// request duration histogram of the whole instance, holding every bucket
+// measured by nginx regardless of the buckets of its class.
+func InstanceLatencyHistogram(rpaasInstance *v1alpha1.RpaasInstance) (string, string) {
+	return vtsServerDurationMetric, instanceMatchers(rpaasInstance) + fmt.Sprintf(`,host=%q`, vtsAllServerZones)
+}
+
+// LatencyHistogram returns the name and the label matchers of the request
+// duration histogram the latency SLIs of the SLO are measured from, see
+// InstanceLatencyHistogram.
+func (s *InstanceSLO) LatencyHistogram() (string, string) {
+	return s.latencyHistogram, s.latencyMatchers
+}
+
+// setSLIRecords makes the SLO record its own SLIs, out of the nginx series
+// selected by matchers, instead of relying on the SLIs of the instance.
+func (s *InstanceSLO) setSLIRecords(requestsMetric, durationMetric, codeLabel, matchers string) {
+	s.latencyHistogram, s.latencyMatchers = durationMetric, matchers
+	s.SLO.ErrorRateRecord.Expr = fmt.Sprintf(`sum(rate(%[1]s{%[2]s,%[3]s="5xx"}[$window])) / sum(rate(%[1]s{%[2]s,%[3]s="total"}[$window]))`,
+		requestsMetric, matchers, codeLabel)
+	s.SLO.LatencyRecord.Expr = fmt.Sprintf(`sum(rate(%[1]s_bucket{%[2]s,le="$le"}[$window])) / sum(rate(%[1]s_count{%[2]s}[$window]))`,
+		durationMetric, matchers)
+}
+
+func sloRulesLabels(rpaasInstance *v1alpha1.RpaasInstance, sloClass *slo.Class, instancePool string) map[string]string {
+	labels := map[string]string{
+		"tsuru_team_owner": alertTeamOwner(rpaasInstance),
+		"rpaas_instance":   rpaasInstance.Labels[rpaasInstanceNameAnnotation],
+		"rpaas_service":    rpaasInstance.Labels[rpaasServiceNameAnnotation],
+		"slo_class":        sloClass.Name,
+	}
+
+	if instancePool != "" {
+		labels["tsuru_pool"] = instancePool
+	}
+
+	return labels
+}
+
+// locationSlug turns a location path into a name suitable to compose SLO
+// names, eg: "/api/checkout" becomes "api-checkout" and "/" becomes "root".
+func locationSlug(path string) string {
+	var sb strings.Builder
+	lastDash := true
+	for _, c := range strings.ToLower(path) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			sb.WriteRune(c)
+			lastDash = false
+			continue
+		}
+		if !lastDash {
+			sb.WriteRune('-')
+			lastDash = true
+		}
+	}
+
+	slug := strings.TrimSuffix(sb.String(), "-")
+	if slug == "" {
+		return "root"
+	}
+
+	return slug
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// StoredRulePrometheusRule is a PrometheusRule, or a shard of them.
+	StoredRulePrometheusRule = "PrometheusRule"
+	// StoredRuleConfigMap is a rule file of a ConfigMap.
+	StoredRuleConfigMap = "ConfigMap"
+	// StoredRuleGroup is a rule group of the ruler API.
+	StoredRuleGroup = "RuleGroup"
+)
+
+// StoredRule locates rules of a SLO on the rules backend, File is the key
+// of the rule file on ConfigMaps.
+type StoredRule struct {
+	Kind      string
+	Namespace string
+	Name      string
+	File      string
+}
+
+// GeneratedSLO is a SLO generated for an instance, along with where its
+// rules are stored.
+type GeneratedSLO struct {
+	InstanceSLO
+	Rules []StoredRule
+}
+
+// GeneratedSLOs returns the SLOs the reconciler generates for the instance,
+// with deprecated classes migrated, and where their rules are stored on the
+// rules namespace recorded for the instance. As when reconciling, SLOs with
+// invalid classes are skipped. Rule groups not placed on shards yet are left
+// out.
+func (r *RpaasInstanceReconciler) GeneratedSLOs(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance) ([]GeneratedSLO, error) {
+	slos, _ := r.instanceSLOs(ctx, rpaasInstance)
+	if len(slos) == 0 {
+		return nil, nil
+	}
+
+	namespace := recordedRulesNamespace(rpaasInstance)
+
+	backend := r.rulesBackend()
+
+	var shards []*monitoringv1.PrometheusRule
+	if _, isDefault := backend.(*prometheusRuleBackend); isDefault && r.RulesShardMaxSize > 0 {
+		list := monitoringv1.PrometheusRuleList{}
+		err := r.Client.List(ctx, &list, client.InNamespace(namespace), client.MatchingLabels{rulesShardLabel: "true"})
+		if err != nil {
+			return nil, err
+		}
+		shards = list.Items
+	}
+
+	var result []GeneratedSLO
+	for _, s := range slos {
+		generated := GeneratedSLO{InstanceSLO: s}
+		prometheusRules := r.instancePrometheusRules(rpaasInstance, []InstanceSLO{s})
+
+		if !r.outputEnabled(OutputPrometheusRules) {
+			result = append(result, generated)
+			continue
+		}
+
+		switch backend.(type) {
+		case *prometheusRuleBackend:
+			if r.RulesShardMaxSize > 0 {
+				generated.Rules = shardsHolding(shards, instanceRuleGroups(rpaasInstance, prometheusRules))
+				break
+			}
+			for _, prometheusRule := range prometheusRules {
+				generated.Rules = append(generated.Rules, StoredRule{Kind: StoredRulePrometheusRule, Namespace: namespace, Name: prometheusRule.Name})
+			}
+		case *ConfigMapRulesBackend:
+			for _, prometheusRule := range prometheusRules {
+				generated.Rules = append(generated.Rules, StoredRule{
+					Kind:      StoredRuleConfigMap,
+					Namespace: namespace,
+					Name:      rulesConfigMapName(rpaasInstance),
+					File:      prometheusRule.Name + ".yaml",
+				})
+			}
+		case *RulerRulesBackend:
+			for _, group := range instanceRuleGroups(rpaasInstance, prometheusRules) {
+				generated.Rules = append(generated.Rules, StoredRule{Kind: StoredRuleGroup, Namespace: namespace, Name: group.Name})
+			}
+		}
+
+		result = append(result, generated)
+	}
+
+	return result, nil
+}
+
+// shardsHolding returns the shards holding any of the groups.
+func shardsHolding(shards []*monitoringv1.PrometheusRule, groups []monitoringv1.RuleGroup) []StoredRule {
+	names := map[string]bool{}
+	for _, group := range groups {
+		names[group.Name] = true
+	}
+
+	var result []StoredRule
+	for _, shard := range shards {
+		if !strings.HasPrefix(shard.Name, rulesShardPrefix) {
+			continue
+		}
+		for _, group := range shard.Spec.Groups {
+			if names[group.Name] {
+				result = append(result, StoredRule{Kind: StoredRulePrometheusRule, Namespace: shard.Namespace, Name: shard.Name})
+				break
+			}
+		}
+	}
+	return result
+}
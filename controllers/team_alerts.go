@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/go-logr/logr"
+	monitoringv1alpha1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/yaml"
+)
+
+// teamAlertsLabel identifies the AlertmanagerConfigs routing the alerts of a
+// team.
+const teamAlertsLabel = "slo.tsuru.io/team-alerts"
+
+// TeamReceivers maps tsuru teams to the Alertmanager receivers of their SLO
+// alerts, eg:
+//
+//	default:
+//	  emailConfigs:
+//	  - to: sre@example.com
+//	teams:
+//	  my-team:
+//	    slackConfigs:
+//	    - channel: "#my-team-alerts"
+//	      apiURL:
+//	        name: my-team-slack
+//	        key: url
+//
+// Secrets referenced by receivers must exist on the rules namespaces. Receiver
+// names are set by the controller.
+type TeamReceivers struct {
+	// Default is the receiver of teams out of Teams, their alerts are not
+	// routed when it is nil.
+	Default *monitoringv1alpha1.Receiver           `json:"default,omitempty"`
+	Teams   map[string]monitoringv1alpha1.Receiver `json:"teams,omitempty"`
+}
+
+// LoadTeamReceivers reads the TeamReceivers from a YAML file.
+func LoadTeamReceivers(path string) (*TeamReceivers, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	receivers := &TeamReceivers{}
+	err = yaml.UnmarshalStrict(data, receivers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid team receivers file %s: %w", path, err)
+	}
+
+	return receivers, nil
+}
+
+func (t *TeamReceivers) receiver(team string) *monitoringv1alpha1.Receiver {
+	if receiver, found := t.Teams[team]; found {
+		return &receiver
+	}
+
+	return t.Default
+}
+
+// rulesNamespaceField indexes the RpaasInstances by the rules namespace
+// recorded for them.
+const rulesNamespaceField = "slo.tsuru.io/rules-namespace"
+
+var _ reconcile.Reconciler = &TeamAlertsReconciler{}
+
+// TeamAlertsReconciler keeps the AlertmanagerConfigs routing the alerts of
+// the teams owning SLOs on each rules namespace. Requests are keyed by the
+// rules namespace, so that the changes of many instances sharing it are
+// handled by a single reconciliation.
+type TeamAlertsReconciler struct {
+	TeamReceivers *TeamReceivers
+
+	// InstanceSelector restricts the RpaasInstances whose teams are routed,
+	// every instance is considered when nil.
+	InstanceSelector labels.Selector
+
+	client.Client
+	Log logr.Logger
+}
+
+func (r *TeamAlertsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx = logr.NewContext(ctx, r.Log.WithValues("rulesNamespace", req.Name))
+	return ctrl.Result{}, r.reconcileTeamAlerts(ctx, req.Name)
+}
+
+func (r *TeamAlertsReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.RpaasInstance{}, rulesNamespaceField, func(obj client.Object) []string {
+		return []string{recordedRulesNamespace(obj.(*v1alpha1.RpaasInstance))}
+	})
+	if err != nil {
+		return err
+	}
+
+	c, err := controller.New("teamalerts", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &v1alpha1.RpaasInstance{}}, rulesNamespacesOfInstance())
+	if err != nil {
+		return err
+	}
+
+	return c.Watch(&source.Kind{Type: &monitoringv1alpha1.AlertmanagerConfig{}},
+		handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetNamespace()}}}
+		}),
+		predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetLabels()[teamAlertsLabel] == "true"
+		}),
+	)
+}
+
+// rulesNamespacesOfInstance maps a RpaasInstance to the rules namespace
+// recorded for it, and to the previous one when it changes. Updates not
+// changing any field used by SLOs are ignored.
+func rulesNamespacesOfInstance() handler.EventHandler {
+	enqueue := func(q workqueue.RateLimitingInterface, obj client.Object) {
+		if rpaasInstance, ok := obj.(*v1alpha1.RpaasInstance); ok {
+			q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: recordedRulesNamespace(rpaasInstance)}})
+		}
+	}
+
+	return handler.Funcs{
+		CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) { enqueue(q, e.Object) },
+		UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			oldInstance, _ := e.ObjectOld.(*v1alpha1.RpaasInstance)
+			newInstance, _ := e.ObjectNew.(*v1alpha1.RpaasInstance)
+			if oldInstance == nil || newInstance == nil {
+				return
+			}
+			if !relevantChanges(oldInstance, newInstance) && recordedRulesNamespace(oldInstance) == recordedRulesNamespace(newInstance) {
+				return
+			}
+			enqueue(q, oldInstance)
+			enqueue(q, newInstance)
+		},
+		DeleteFunc:  func(e event.DeleteEvent, q workqueue.RateLimitingInterface) { enqueue(q, e.Object) },
+		GenericFunc: func(e event.GenericEvent, q workqueue.RateLimitingInterface) { enqueue(q, e.Object) },
+	}
+}
+
+// reconcileTeamAlerts keeps an AlertmanagerConfig for each team owning SLOs
+// whose rules live on the namespace, routing the alerts of the team to its
+// receiver.
+func (r *TeamAlertsReconciler) reconcileTeamAlerts(ctx context.Context, namespace string) error {
+	log := loggerFrom(ctx, r.Log)
+
+	// the index only narrows the list down, clients without it list every
+	// instance
+	instances := v1alpha1.RpaasInstanceList{}
+	err := r.Client.List(ctx, &instances, client.MatchingFields{rulesNamespaceField: namespace})
+	if err != nil {
+		log.Error(err, "could not list RpaasInstances")
+		return err
+	}
+
+	teams := map[string]bool{}
+	for i := range instances.Items {
+		rpaasInstance := &instances.Items[i]
+		if rpaasInstance.DeletionTimestamp != nil || recordedRulesNamespace(rpaasInstance) != namespace || !selected(r.InstanceSelector, rpaasInstance) {
+			continue
+		}
+
+		team := alertTeamOwner(rpaasInstance)
+		if team == "" || teams[team] {
+			continue
+		}
+
+		slos, _ := InstanceSLOs(rpaasInstance, nil)
+		teams[team] = len(slos) > 0
+	}
+
+	var desired []*monitoringv1alpha1.AlertmanagerConfig
+	for _, team := range sortedTeams(teams) {
+		receiver := r.TeamReceivers.receiver(team)
+		if receiver == nil {
+			log.Info("no alert receiver for team", "team", team)
+			continue
+		}
+		desired = append(desired, teamAlertmanagerConfig(namespace, team, *receiver))
+	}
+
+	existingList := monitoringv1alpha1.AlertmanagerConfigList{}
+	err = r.Client.List(ctx, &existingList, &client.ListOptions{
+		Namespace:     namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{teamAlertsLabel: "true"}),
+	})
+	if err != nil {
+		log.Error(err, "could not list AlertmanagerConfigs",
+			"rulesNamespace", namespace,
+		)
+		return err
+	}
+
+	existing := map[string]*monitoringv1alpha1.AlertmanagerConfig{}
+	for _, config := range existingList.Items {
+		existing[config.Name] = config
+	}
+
+	for _, config := range desired {
+		current, found := existing[config.Name]
+		if !found {
+			err = r.Client.Create(ctx, config)
+			if err != nil {
+				log.Error(err, "could not create AlertmanagerConfig",
+					"object", config.Name,
+					"rulesNamespace", namespace,
+				)
+				return err
+			}
+			continue
+		}
+
+		delete(existing, config.Name)
+		config.ResourceVersion = current.ResourceVersion
+		err = r.Client.Update(ctx, config)
+		if err != nil {
+			log.Error(err, "could not update AlertmanagerConfig",
+				"object", config.Name,
+				"rulesNamespace", namespace,
+			)
+			return err
+		}
+	}
+
+	for _, config := range existing {
+		err = r.Client.Delete(ctx, config)
+		if err != nil {
+			log.Error(err, "could not remove unused AlertmanagerConfig",
+				"object", config.Name,
+				"rulesNamespace", namespace,
+			)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// teamAlertmanagerConfig routes the SLO alerts of the team, grouped by
+// instance and class, to the receiver.
+func teamAlertmanagerConfig(namespace, team string, receiver monitoringv1alpha1.Receiver) *monitoringv1alpha1.AlertmanagerConfig {
+	receiver.Name = team
+
+	config := &monitoringv1alpha1.AlertmanagerConfig{}
+	config.Name = "slo-team-" + team
+	config.Namespace = namespace
+	config.Labels = map[string]string{
+		teamAlertsLabel:          "true",
+		rpaasTeamOwnerAnnotation: team,
+	}
+	config.Spec.Route = &monitoringv1alpha1.Route{
+		Receiver: team,
+		GroupBy:  []string{"rpaas_instance", "slo_class"},
+		Matchers: []monitoringv1alpha1.Matcher{
+			{
+				Name:  "tsuru_team_owner",
+				Value: team,
+			},
+		},
+	}
+	config.Spec.Receivers = []monitoringv1alpha1.Receiver{receiver}
+
+	return config
+}
+
+// alertTeamOwner returns the team set on the tsuru_team_owner label of the
+// alerts of the instance.
+func alertTeamOwner(rpaasInstance *v1alpha1.RpaasInstance) string {
+	return rpaasInstance.ObjectMeta.Annotations[rpaasTeamOwnerAnnotation]
+}
+
+func sortedTeams(teams map[string]bool) []string {
+	var result []string
+	for team, hasSLOs := range teams {
+		if hasSLOs {
+			result = append(result, team)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
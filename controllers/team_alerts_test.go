@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileTeamAlerts(t *testing.T) {
+	ctx := context.TODO()
+
+	receiversFile := filepath.Join(t.TempDir(), "receivers.yaml")
+	err := ioutil.WriteFile(receiversFile, []byte(`
+default:
+  emailConfigs:
+  - to: sre@example.com
+teams:
+  team-a:
+    slackConfigs:
+    - channel: "#team-a"
+      apiURL:
+        name: team-a-slack
+        key: url
+`), 0644)
+	require.NoError(t, err)
+
+	teamReceivers, err := LoadTeamReceivers(receiversFile)
+	require.NoError(t, err)
+
+	instance := func(namespace, name, team, tags string) *v1alpha1.RpaasInstance {
+		return &v1alpha1.RpaasInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Labels: map[string]string{
+					rpaasInstanceNameAnnotation: name,
+					rpaasServiceNameAnnotation:  "rpaasv2",
+				},
+				Annotations: map[string]string{
+					rpaasTeamOwnerAnnotation: team,
+					rpaasTagsAnnotation:      tags,
+				},
+			},
+		}
+	}
+
+	instance1 := instance("rpaasv2-fe-pool1", "instance1", "team-a", "slo:critical")
+	// rules kept on the namespace of the previous pool
+	instance5 := instance("rpaasv2-fe-pool3", "instance5", "team-e", "slo:high")
+	instance5.Annotations[rulesNamespaceAnnotation] = "tsuru-pool1"
+	// rules moved to the namespace of another pool
+	instance6 := instance("rpaasv2-fe-pool1", "instance6", "team-f", "slo:high")
+	instance6.Annotations[rulesNamespaceAnnotation] = "tsuru-pool2"
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			instance1,
+			instance("rpaasv2-be-pool1", "instance2", "team-b", "slo:high"),
+			instance("rpaasv2-be-pool1", "instance3", "team-c", ""),
+			instance("rpaasv2-be-pool2", "instance4", "team-d", "slo:high"),
+			instance5,
+			instance6,
+		).Build()
+	reconciler := &TeamAlertsReconciler{
+		TeamReceivers: teamReceivers,
+		Client:        k8sClient,
+		Log:           ctrl.Log,
+	}
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{Name: "tsuru-pool1"},
+	}
+	_, err = reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	configs := monitoringv1alpha1.AlertmanagerConfigList{}
+	err = k8sClient.List(ctx, &configs, client.InNamespace("tsuru-pool1"))
+	require.NoError(t, err)
+	require.Len(t, configs.Items, 3)
+
+	teamA := configs.Items[0]
+	assert.Equal(t, "slo-team-team-a", teamA.Name)
+	assert.Equal(t, &monitoringv1alpha1.Route{
+		Receiver: "team-a",
+		GroupBy:  []string{"rpaas_instance", "slo_class"},
+		Matchers: []monitoringv1alpha1.Matcher{{Name: "tsuru_team_owner", Value: "team-a"}},
+	}, teamA.Spec.Route)
+	require.Len(t, teamA.Spec.Receivers, 1)
+	assert.Equal(t, "team-a", teamA.Spec.Receivers[0].Name)
+	require.Len(t, teamA.Spec.Receivers[0].SlackConfigs, 1)
+	assert.Equal(t, "#team-a", teamA.Spec.Receivers[0].SlackConfigs[0].Channel)
+
+	teamB := configs.Items[1]
+	assert.Equal(t, "slo-team-team-b", teamB.Name)
+	require.Len(t, teamB.Spec.Receivers, 1)
+	assert.Equal(t, "team-b", teamB.Spec.Receivers[0].Name)
+	require.Len(t, teamB.Spec.Receivers[0].EmailConfigs, 1)
+	assert.Equal(t, "sre@example.com", teamB.Spec.Receivers[0].EmailConfigs[0].To)
+
+	assert.Equal(t, "slo-team-team-e", configs.Items[2].Name)
+
+	require.NoError(t, k8sClient.Get(ctx, client.ObjectKeyFromObject(instance1), instance1))
+	instance1.Annotations[rpaasTeamOwnerAnnotation] = "team-b"
+	err = k8sClient.Update(ctx, instance1)
+	require.NoError(t, err)
+
+	_, err = reconciler.Reconcile(ctx, request)
+	require.NoError(t, err)
+
+	err = k8sClient.List(ctx, &configs, client.InNamespace("tsuru-pool1"))
+	require.NoError(t, err)
+	require.Len(t, configs.Items, 2)
+	assert.Equal(t, "slo-team-team-b", configs.Items[0].Name)
+	assert.Equal(t, "slo-team-team-e", configs.Items[1].Name)
+}
+
+func TestRulesNamespacesOfInstance(t *testing.T) {
+	oldInstance := &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "rpaasv2-fe-pool2",
+			Name:      "instance1",
+			Annotations: map[string]string{
+				rpaasTagsAnnotation:      "slo:high",
+				rulesNamespaceAnnotation: "tsuru-pool1",
+			},
+		},
+	}
+
+	requests := func(e event.UpdateEvent) []reconcile.Request {
+		queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		defer queue.ShutDown()
+
+		rulesNamespacesOfInstance().Update(e, queue)
+
+		var result []reconcile.Request
+		for queue.Len() > 0 {
+			item, _ := queue.Get()
+			result = append(result, item.(reconcile.Request))
+			queue.Done(item)
+		}
+		return result
+	}
+
+	statusUpdate := oldInstance.DeepCopy()
+	statusUpdate.Status.ObservedGeneration = 2
+	assert.Empty(t, requests(event.UpdateEvent{ObjectOld: oldInstance, ObjectNew: statusUpdate}))
+
+	moved := oldInstance.DeepCopy()
+	moved.Annotations[rulesNamespaceAnnotation] = "tsuru-pool2"
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "tsuru-pool1"}},
+		{NamespacedName: types.NamespacedName{Name: "tsuru-pool2"}},
+	}, requests(event.UpdateEvent{ObjectOld: oldInstance, ObjectNew: moved}))
+
+	retagged := oldInstance.DeepCopy()
+	retagged.Annotations[rpaasTagsAnnotation] = "slo:critical"
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "tsuru-pool1"}},
+	}, requests(event.UpdateEvent{ObjectOld: oldInstance, ObjectNew: retagged}))
+}
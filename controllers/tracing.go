@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"context"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/tsuru/rpaas-slo-controller/controllers"
+
+func (r *RpaasInstanceReconciler) startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	provider := r.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	return provider.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// startRuleSpan starts a child span of an operation on a PrometheusRule.
+func (r *RpaasInstanceReconciler) startRuleSpan(ctx context.Context, name string, prometheusRule *monitoringv1.PrometheusRule) (context.Context, trace.Span) {
+	return r.startSpan(ctx, name,
+		attribute.String("rule", prometheusRule.Name),
+		attribute.String("rulesNamespace", prometheusRule.Namespace),
+	)
+}
+
+// endSpan records the error, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
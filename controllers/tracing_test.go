@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileRpaasInstanceTracing(t *testing.T) {
+	ctx := context.TODO()
+	instance1 := newShardedInstance("instance1")
+
+	exporter := tracetest.NewInMemoryExporter()
+	reconciler := &RpaasInstanceReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithRuntimeObjects(instance1).Build(),
+		Log:            ctrl.Log,
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+	}
+
+	_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance1)})
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	names := map[string]int{}
+	var root tracetest.SpanStub
+	for _, span := range spans {
+		names[span.Name]++
+		if span.Name == "Reconcile" {
+			root = span
+		}
+	}
+
+	assert.Equal(t, map[string]int{
+		"Reconcile":            1,
+		"RenderAlertTemplates": 1,
+		"GenerateSLOs":         1,
+		"ApplyRules":           1,
+		"ListPrometheusRules":  1,
+		"CreatePrometheusRule": 1,
+	}, names)
+
+	assert.Equal(t, "instance1", attributeValue(root, "instance"))
+	assert.Equal(t, "rpaasv2-fe-pool1", attributeValue(root, "namespace"))
+	assert.NotEmpty(t, attributeValue(root, "reconcileID"))
+
+	for _, span := range spans {
+		assert.Equal(t, root.SpanContext.TraceID(), span.SpanContext.TraceID(), span.Name)
+		if span.Name == "CreatePrometheusRule" {
+			assert.Equal(t, "slos-alerts-tsuru.rpaasv2-fe-pool1.instance1", attributeValue(span, "rule"))
+		}
+	}
+}
+
+func attributeValue(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package definition
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globocom/slo-generator/slo"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+)
+
+// ScheduleAnnotation holds a JSON object declaring the SLO classes in force
+// on time windows, the class of the slo tag is in force out of them, eg:
+// {"timezone": "America/Sao_Paulo", "windows": [{"days": ["mon-fri"], "hours": "9-18", "class": "critical"}]}
+const ScheduleAnnotation = "rpaas.extensions.tsuru.io/slo-schedule"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule is a set of time windows, each one with its own SLO class.
+type Schedule struct {
+	Location *time.Location
+	Windows  []ScheduleWindow
+}
+
+// ScheduleWindow is a time window of a Schedule. It matches the hours from
+// StartHour (inclusive) to EndHour (exclusive) of Days, windows crossing
+// midnight have an EndHour lower than StartHour. Every day is matched when
+// Days is empty.
+type ScheduleWindow struct {
+	Days      []time.Weekday
+	StartHour int
+	EndHour   int
+	Class     *slo.Class
+}
+
+type scheduleSpec struct {
+	Timezone string               `json:"timezone"`
+	Windows  []scheduleWindowSpec `json:"windows"`
+}
+
+type scheduleWindowSpec struct {
+	Days  []string `json:"days"`
+	Hours string   `json:"hours"`
+	Class string   `json:"class"`
+}
+
+// SLOSchedule returns the schedule declared on ScheduleAnnotation, if any.
+// The schedule requires the instance to have a SLO class.
+func SLOSchedule(instance *v1alpha1.RpaasInstance) (*Schedule, error) {
+	raw := instance.ObjectMeta.Annotations[ScheduleAnnotation]
+	if raw == "" {
+		return nil, nil
+	}
+
+	spec := scheduleSpec{}
+	err := json.Unmarshal([]byte(raw), &spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", ScheduleAnnotation, err)
+	}
+
+	if class, _ := SLOClass(instance); class == nil {
+		return nil, fmt.Errorf("%s annotation requires a slo tag, whose class is in force out of the windows", ScheduleAnnotation)
+	}
+
+	location, err := time.LoadLocation(spec.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", spec.Timezone, err)
+	}
+
+	if len(spec.Windows) == 0 {
+		return nil, fmt.Errorf("%s annotation has no windows", ScheduleAnnotation)
+	}
+
+	schedule := &Schedule{Location: location}
+	for i, windowSpec := range spec.Windows {
+		window, err := parseScheduleWindow(windowSpec)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: %w", i, err)
+		}
+		schedule.Windows = append(schedule.Windows, window)
+	}
+
+	return schedule, nil
+}
+
+func parseScheduleWindow(spec scheduleWindowSpec) (ScheduleWindow, error) {
+	window := ScheduleWindow{}
+
+	class, err := classesDefinition.FindClass(strings.ToLower(spec.Class))
+	if err != nil {
+		return window, err
+	}
+	if class == nil {
+		return window, fmt.Errorf("missing class")
+	}
+	window.Class = class
+
+	for _, days := range spec.Days {
+		parsed, err := parseDays(strings.ToLower(days))
+		if err != nil {
+			return window, err
+		}
+		window.Days = append(window.Days, parsed...)
+	}
+
+	window.StartHour, window.EndHour, err = parseHours(spec.Hours)
+	if err != nil {
+		return window, err
+	}
+
+	return window, nil
+}
+
+// parseDays parses a weekday, eg: "mon", or a range of weekdays, eg:
+// "mon-fri" or "sat-sun".
+func parseDays(days string) ([]time.Weekday, error) {
+	parts := strings.SplitN(days, "-", 2)
+	first, ok := weekdays[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("invalid day %q", parts[0])
+	}
+	if len(parts) == 1 {
+		return []time.Weekday{first}, nil
+	}
+
+	last, ok := weekdays[parts[1]]
+	if !ok {
+		return nil, fmt.Errorf("invalid day %q", parts[1])
+	}
+
+	result := []time.Weekday{first}
+	for day := first; day != last; {
+		day = (day + 1) % 7
+		result = append(result, day)
+	}
+
+	return result, nil
+}
+
+// parseHours parses a range of hours, eg: "9-18" or "22-6". Every hour is
+// matched when the range is empty.
+func parseHours(hours string) (int, int, error) {
+	if hours == "" {
+		return 0, 24, nil
+	}
+
+	parts := strings.SplitN(hours, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid hours %q, expected a range like 9-18", hours)
+	}
+
+	var result [2]int
+	for i, part := range parts {
+		hour, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || hour < 0 || hour > 23+i {
+			return 0, 0, fmt.Errorf("invalid hour %q", part)
+		}
+		result[i] = hour
+	}
+
+	if result[1] == 0 {
+		result[1] = 24
+	}
+
+	if result[0] == result[1] {
+		return 0, 0, fmt.Errorf("invalid hours %q, the range is empty", hours)
+	}
+
+	return result[0], result[1], nil
+}
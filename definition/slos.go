@@ -1,15 +1,29 @@
 package definition
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/globocom/slo-generator/methods"
 	"github.com/globocom/slo-generator/slo"
 	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
-	rpaasTagsAnnotation = "rpaas.extensions.tsuru.io/tags"
+	// TagsAnnotation holds the comma separated tsuru tags of the instance,
+	// the SLO class is set by a tag like slo:critical.
+	TagsAnnotation = "rpaas.extensions.tsuru.io/tags"
+
+	// LocationSLOsAnnotation holds a JSON object mapping location paths to
+	// SLO classes, eg: {"/api/checkout": "critical", "/static": "low"}
+	LocationSLOsAnnotation = "rpaas.extensions.tsuru.io/slo-locations"
+
+	// HostSLOsAnnotation holds a JSON object mapping virtual hosts to SLO
+	// classes, eg: {"www.example.com": "critical", "static.example.com": "low"}
+	HostSLOsAnnotation = "rpaas.extensions.tsuru.io/slo-hosts"
 )
 
 var classesDefinition = slo.ClassesDefinition{
@@ -109,18 +123,148 @@ var classesDefinition = slo.ClassesDefinition{
 	},
 }
 
-func SLOClass(instance *v1alpha1.RpaasInstance) (*slo.Class, error) {
-	tagsRaw := instance.ObjectMeta.Annotations[rpaasTagsAnnotation]
+// deprecatedClasses maps deprecated SLO classes to their replacements.
+// Deprecated classes are still accepted, but should not be used anymore.
+var deprecatedClasses = map[string]string{
+	"high_slow": "high",
+}
+
+// Deprecation is a deprecated SLO class in use by an instance.
+type Deprecation struct {
+	// Source is where the class is declared, eg: `tag`, `location "/api"` or
+	// `virtual host "www.example.com"`.
+	Source      string
+	Class       string
+	Replacement string
+}
+
+func (d Deprecation) String() string {
+	return fmt.Sprintf("SLO class %q of %s is deprecated, use %q instead", d.Class, d.Source, d.Replacement)
+}
+
+// Classes returns the available SLO classes, from the strictest to the
+// loosest one.
+func Classes() []slo.Class {
+	return classesDefinition.Classes
+}
+
+// ValidateClasses checks the SLO classes definition: every class must have
+// a unique name and an availability objective, and deprecated classes and
+// their replacements must be found by Class, as the classes of instances.
+func ValidateClasses() error {
+	if len(classesDefinition.Classes) == 0 {
+		return fmt.Errorf("no SLO classes defined")
+	}
+
+	names := map[string]bool{}
+	for _, class := range classesDefinition.Classes {
+		if class.Name == "" || names[class.Name] {
+			return fmt.Errorf("SLO class %q is defined more than once or has no name", class.Name)
+		}
+		names[class.Name] = true
+
+		if class.Objectives.Availability <= 0 || class.Objectives.Availability > 100 {
+			return fmt.Errorf("SLO class %q has an invalid availability objective: %v", class.Name, class.Objectives.Availability)
+		}
+	}
+
+	for name, replacement := range deprecatedClasses {
+		if _, err := Class(name); err != nil {
+			return fmt.Errorf("deprecated SLO class %q cannot be found: %w", name, err)
+		}
+		if _, err := Class(replacement); err != nil {
+			return fmt.Errorf("replacement %q of deprecated SLO class %q cannot be found: %w", replacement, name, err)
+		}
+	}
+
+	return nil
+}
+
+// Class returns the SLO class with the given name.
+func Class(name string) (*slo.Class, error) {
+	class, err := classesDefinition.FindClass(strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	if class == nil {
+		return nil, fmt.Errorf("missing SLO class")
+	}
+
+	return class, nil
+}
+
+// Replacement returns the class replacing a deprecated class, or nil when
+// the class is not deprecated.
+func Replacement(class *slo.Class) *slo.Class {
+	if class == nil {
+		return nil
+	}
+
+	name, deprecated := deprecatedClasses[class.Name]
+	if !deprecated {
+		return nil
+	}
+
+	replacement, err := classesDefinition.FindClass(name)
+	if err != nil {
+		return nil
+	}
+
+	return replacement
+}
+
+// Deprecations returns the deprecated classes used by the instance, invalid
+// classes are ignored.
+func Deprecations(instance *v1alpha1.RpaasInstance) []Deprecation {
+	var deprecations []Deprecation
+	add := func(source string, class *slo.Class) {
+		if replacement := Replacement(class); replacement != nil {
+			deprecations = append(deprecations, Deprecation{
+				Source:      source,
+				Class:       class.Name,
+				Replacement: replacement.Name,
+			})
+		}
+	}
+
+	class, _ := SLOClass(instance)
+	add("tag", class)
+
+	locationClasses, _ := LocationSLOClasses(instance)
+	for _, location := range sortedKeys(locationClasses) {
+		add(fmt.Sprintf("location %q", location), locationClasses[location])
+	}
+
+	hostClasses, _ := HostSLOClasses(instance)
+	for _, host := range sortedKeys(hostClasses) {
+		add(fmt.Sprintf("virtual host %q", host), hostClasses[host])
+	}
+
+	return deprecations
+}
+
+// SLOClassName returns the SLO class declared on the tags of the instance,
+// which may not be a valid class, or an empty string when there is none.
+func SLOClassName(instance *v1alpha1.RpaasInstance) string {
+	tagsRaw := instance.ObjectMeta.Annotations[TagsAnnotation]
 	var tags []string
 	if tagsRaw != "" {
 		tags = strings.Split(tagsRaw, ",")
 	}
-	sloTags := extractTagValues([]string{"slo:", "SLO:", "slo=", "SLO="}, tags)
+	sloTags := extractTagValues(sloTagPrefixes, tags)
 	if len(sloTags) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(sloTags[0])
+}
+
+func SLOClass(instance *v1alpha1.RpaasInstance) (*slo.Class, error) {
+	class := SLOClassName(instance)
+	if class == "" {
 		return nil, nil
 	}
 
-	class := strings.ToLower(sloTags[0])
 	sloClass, err := classesDefinition.FindClass(class)
 	if err != nil {
 		return nil, err
@@ -130,6 +274,104 @@ func SLOClass(instance *v1alpha1.RpaasInstance) (*slo.Class, error) {
 
 }
 
+// LocationSLOClasses returns the SLO class of each location path declared on
+// LocationSLOsAnnotation, paths without a class are omitted.
+func LocationSLOClasses(instance *v1alpha1.RpaasInstance) (map[string]*slo.Class, error) {
+	return annotatedSLOClasses(instance, LocationSLOsAnnotation)
+}
+
+// HostSLOClasses returns the SLO class of each virtual host declared on
+// HostSLOsAnnotation, hosts without a class are omitted.
+func HostSLOClasses(instance *v1alpha1.RpaasInstance) (map[string]*slo.Class, error) {
+	classes, err := annotatedSLOClasses(instance, HostSLOsAnnotation)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]*slo.Class{}
+	for host, class := range classes {
+		if errs := validation.IsDNS1123Subdomain(strings.ToLower(host)); len(errs) > 0 {
+			return nil, fmt.Errorf("host %q: %s", host, strings.Join(errs, ", "))
+		}
+		result[strings.ToLower(host)] = class
+	}
+
+	return result, nil
+}
+
+func annotatedSLOClasses(instance *v1alpha1.RpaasInstance, annotation string) (map[string]*slo.Class, error) {
+	raw := instance.ObjectMeta.Annotations[annotation]
+	if raw == "" {
+		return nil, nil
+	}
+
+	classes := map[string]string{}
+	err := json.Unmarshal([]byte(raw), &classes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", annotation, err)
+	}
+
+	result := map[string]*slo.Class{}
+	for key, class := range classes {
+		sloClass, err := classesDefinition.FindClass(strings.ToLower(class))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", key, err)
+		}
+		if sloClass == nil {
+			continue
+		}
+		result[key] = sloClass
+	}
+
+	return result, nil
+}
+
+func sortedKeys(classes map[string]*slo.Class) []string {
+	keys := make([]string, 0, len(classes))
+	for key := range classes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetSLOClassTag replaces the slo tags of the comma separated tags by a
+// single slo:<class> tag, keeping the position of the first one and every
+// other tag.
+func SetSLOClassTag(tagsRaw, class string) string {
+	var tags []string
+	replaced := false
+	for _, tag := range strings.Split(tagsRaw, ",") {
+		if tag == "" {
+			continue
+		}
+		if !isSLOTag(tag) {
+			tags = append(tags, tag)
+			continue
+		}
+		if !replaced {
+			tags = append(tags, "slo:"+class)
+			replaced = true
+		}
+	}
+	if !replaced {
+		tags = append(tags, "slo:"+class)
+	}
+
+	return strings.Join(tags, ",")
+}
+
+var sloTagPrefixes = []string{"slo:", "SLO:", "slo=", "SLO="}
+
+func isSLOTag(tag string) bool {
+	for _, p := range sloTagPrefixes {
+		if strings.HasPrefix(tag, p) {
+			return true
+		}
+	}
+	return false
+}
+
 func extractTagValues(prefixes, tags []string) []string {
 	for _, t := range tags {
 		for _, p := range prefixes {
@@ -0,0 +1,19 @@
+package definition
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateClasses(t *testing.T) {
+	assert.NoError(t, ValidateClasses())
+
+	defer func(classes map[string]string) { deprecatedClasses = classes }(deprecatedClasses)
+
+	deprecatedClasses = map[string]string{"high_slow": "highest"}
+	assert.EqualError(t, ValidateClasses(), `replacement "highest" of deprecated SLO class "high_slow" cannot be found: SLO class "highest" is not found`)
+
+	deprecatedClasses = map[string]string{"low_slow": "low"}
+	assert.EqualError(t, ValidateClasses(), `deprecated SLO class "low_slow" cannot be found: SLO class "low_slow" is not found`)
+}
@@ -6,15 +6,24 @@ require (
 	github.com/elastic/gosigar v0.9.0 // indirect
 	github.com/globocom/slo-generator v0.2.2-0.20210922120954-fe6dee4f2f6e
 	github.com/go-logr/logr v0.4.0
-	github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring v0.50.0 // indirect
-	github.com/slok/kubewebhook/v2 v2.1.0 // indirect
-	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring v0.50.0
+	github.com/prometheus/client_golang v1.11.0
+	github.com/prometheus/common v0.30.0
+	github.com/prometheus/prometheus v1.8.2-0.20210914090109-37468d88dce8
+	github.com/slok/kubewebhook/v2 v2.1.0
+	github.com/stretchr/testify v1.7.0
 	github.com/tsuru/rpaas-operator v0.19.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	go.uber.org/zap v1.19.0
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
-	k8s.io/api v0.22.2 // indirect
+	k8s.io/api v0.22.2
 	k8s.io/apimachinery v0.22.2
 	k8s.io/client-go v0.22.2
 	sigs.k8s.io/controller-runtime v0.10.1
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace github.com/docker/docker => github.com/docker/engine v0.0.0-20190219214528-cbe11bdc6da8
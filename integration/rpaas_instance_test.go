@@ -0,0 +1,126 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hasClass tells whether the alerts of the rule are of the SLO class.
+func hasClass(class string) func(*monitoringv1.PrometheusRule) bool {
+	return func(rule *monitoringv1.PrometheusRule) bool {
+		for _, group := range rule.Spec.Groups {
+			for _, r := range group.Rules {
+				if r.Alert != "" && r.Labels["slo_class"] == class {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+func TestInstanceLifecycle(t *testing.T) {
+	skipWithoutEnvironment(t)
+	ctx := context.TODO()
+
+	rpaasInstance := newInstance("default", "lifecycle", "slo:critical")
+	require.NoError(t, k8sClient.Create(ctx, rpaasInstance))
+	key := client.ObjectKey{Namespace: "default", Name: "slos-alerts-tsuru.default.lifecycle"}
+
+	rule := eventuallyRule(t, key, hasClass("critical"))
+	_true := true
+	assert.Equal(t, []metav1.OwnerReference{{
+		APIVersion:         "extensions.tsuru.io/v1alpha1",
+		Kind:               "RpaasInstance",
+		Name:               "lifecycle",
+		UID:                rpaasInstance.UID,
+		Controller:         &_true,
+		BlockOwnerDeletion: &_true,
+	}}, rule.OwnerReferences)
+
+	// class change
+	require.NoError(t, updateTags(rpaasInstance, "env:prod,slo:high"))
+	eventuallyRule(t, key, hasClass("high"))
+
+	// tag removal
+	require.NoError(t, updateTags(rpaasInstance, "env:prod"))
+	eventuallyRemoved(t, key)
+
+	// envtest runs no garbage collector, the rules are removed by the
+	// reconciler
+	require.NoError(t, updateTags(rpaasInstance, "slo:low"))
+	eventuallyRule(t, key, hasClass("low"))
+	require.NoError(t, k8sClient.Delete(ctx, rpaasInstance))
+	eventuallyRemoved(t, key)
+}
+
+func TestPoolNamespaceInstance(t *testing.T) {
+	skipWithoutEnvironment(t)
+	ctx := context.TODO()
+
+	frontend := newInstance("rpaasv2-fe-pool1", "pooled", "slo:critical")
+	backend := newInstance("rpaasv2-be-pool1", "pooled", "slo:high")
+	require.NoError(t, k8sClient.Create(ctx, frontend))
+	require.NoError(t, k8sClient.Create(ctx, backend))
+	frontendKey := client.ObjectKey{Namespace: "tsuru-pool1", Name: "slos-alerts-tsuru.rpaasv2-fe-pool1.pooled"}
+	backendKey := client.ObjectKey{Namespace: "tsuru-pool1", Name: "slos-alerts-tsuru.rpaasv2-be-pool1.pooled"}
+
+	rule := eventuallyRule(t, frontendKey, hasClass("critical"))
+	assert.Empty(t, rule.OwnerReferences)
+	eventuallyRule(t, backendKey, hasClass("high"))
+
+	// the label selectors match on the API server
+	list := monitoringv1.PrometheusRuleList{}
+	require.NoError(t, k8sClient.List(ctx, &list, client.InNamespace("tsuru-pool1"), client.MatchingLabels{
+		"rpaas.extensions.tsuru.io/instance-name": "pooled",
+		"tsuru.io/pool": "pool1",
+	}))
+	var owners []controllers.Owner
+	for _, rule := range list.Items {
+		owners = append(owners, controllers.ObjectOwner(rule))
+	}
+	assert.ElementsMatch(t, []controllers.Owner{
+		{Service: "rpaasv2", Instance: "pooled", Team: "my-team", Pool: "pool1", Namespace: "rpaasv2-fe-pool1"},
+		{Service: "rpaasv2", Instance: "pooled", Team: "my-team", Pool: "pool1", Namespace: "rpaasv2-be-pool1"},
+	}, owners)
+
+	// same-named instances keep their own rules
+	require.NoError(t, updateTags(frontend, "slo:low"))
+	eventuallyRule(t, frontendKey, hasClass("low"))
+	eventuallyRule(t, backendKey, hasClass("high"))
+
+	require.NoError(t, k8sClient.Delete(ctx, frontend))
+	eventuallyRemoved(t, frontendKey)
+	eventuallyRule(t, backendKey, hasClass("high"))
+
+	require.NoError(t, k8sClient.Delete(ctx, backend))
+	eventuallyRemoved(t, backendKey)
+}
+
+func TestWebhook(t *testing.T) {
+	skipWithoutEnvironment(t)
+	ctx := context.TODO()
+
+	err := k8sClient.Create(ctx, newInstance("default", "invalid", "slo:platinum"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid SLO class")
+
+	rpaasInstance := newInstance("default", "webhook", "slo:high")
+	require.NoError(t, k8sClient.Create(ctx, rpaasInstance))
+	err = updateTags(rpaasInstance, "slo:platinum")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid SLO class")
+
+	current := &v1alpha1.RpaasInstance{}
+	require.NoError(t, k8sClient.Get(ctx, client.ObjectKeyFromObject(rpaasInstance), current))
+	assert.Equal(t, "slo:high", current.Annotations["rpaas.extensions.tsuru.io/tags"])
+	require.NoError(t, k8sClient.Delete(ctx, current))
+}
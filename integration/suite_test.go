@@ -0,0 +1,229 @@
+// Package integration runs the manager and the admission webhook against a
+// local API server started by envtest. Tests are skipped unless
+// KUBEBUILDER_ASSETS points to the envtest binaries.
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	"github.com/tsuru/rpaas-slo-controller/webhook"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const (
+	timeout  = 10 * time.Second
+	interval = 100 * time.Millisecond
+)
+
+var (
+	scheme = runtime.NewScheme()
+
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	_ = monitoringv1.AddToScheme(scheme)
+
+	// k8sClient reads straight from the API server, bypassing the cache of
+	// the manager.
+	k8sClient client.Client
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		os.Exit(m.Run())
+	}
+
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "external")},
+		ErrorIfCRDPathMissing: true,
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			ValidatingWebhooks: []admissionv1.ValidatingWebhookConfiguration{validatingWebhook()},
+		},
+	}
+
+	code, err := run(m, testEnv)
+	if stopErr := testEnv.Stop(); err == nil {
+		err = stopErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+func run(m *testing.M, testEnv *envtest.Environment) (int, error) {
+	cfg, err := testEnv.Start()
+	if err != nil {
+		return 0, err
+	}
+
+	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, namespace := range []string{"rpaasv2-fe-pool1", "rpaasv2-be-pool1", "tsuru-pool1"} {
+		err = k8sClient.Create(context.Background(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme,
+		MetricsBindAddress: "0",
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = (&controllers.RpaasInstanceReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("RpaasInstanceReconciler"),
+		Recorder: mgr.GetEventRecorderFor("rpaas-slo-controller"),
+	}).SetupWithManager(mgr)
+	if err != nil {
+		return 0, err
+	}
+
+	options := testEnv.WebhookInstallOptions
+	webhookServer := &webhook.Server{
+		Addr:     net.JoinHostPort(options.LocalServingHost, strconv.Itoa(options.LocalServingPort)),
+		Log:      ctrl.Log.WithName("webhook"),
+		CertFile: filepath.Join(options.LocalServingCertDir, "tls.crt"),
+		KeyFile:  filepath.Join(options.LocalServingCertDir, "tls.key"),
+	}
+	err = mgr.Add(webhookServer)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- mgr.Start(ctx)
+	}()
+
+	for webhookServer.Check(nil) != nil {
+		select {
+		case err = <-done:
+			return 0, fmt.Errorf("manager stopped: %v", err)
+		case <-time.After(interval):
+		}
+	}
+
+	code := m.Run()
+	cancel()
+	return code, <-done
+}
+
+// validatingWebhook points the API server to the webhook, envtest replaces
+// the service with the local address and sets the CA bundle.
+func validatingWebhook() admissionv1.ValidatingWebhookConfiguration {
+	path := "/"
+	failurePolicy := admissionv1.Fail
+	sideEffects := admissionv1.SideEffectClassNone
+
+	return admissionv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "rpaas-slo-controller"},
+		Webhooks: []admissionv1.ValidatingWebhook{{
+			Name: "rpaasinstances.slo.tsuru.io",
+			ClientConfig: admissionv1.WebhookClientConfig{
+				Service: &admissionv1.ServiceReference{
+					Namespace: "default",
+					Name:      "rpaas-slo-controller",
+					Path:      &path,
+				},
+			},
+			Rules: []admissionv1.RuleWithOperations{{
+				Operations: []admissionv1.OperationType{admissionv1.Create, admissionv1.Update},
+				Rule: admissionv1.Rule{
+					APIGroups:   []string{"extensions.tsuru.io"},
+					APIVersions: []string{"v1alpha1"},
+					Resources:   []string{"rpaasinstances"},
+				},
+			}},
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1"},
+		}},
+	}
+}
+
+func skipWithoutEnvironment(t *testing.T) {
+	if k8sClient == nil {
+		t.Skip("KUBEBUILDER_ASSETS is not set")
+	}
+}
+
+func newInstance(namespace, name, tags string) *v1alpha1.RpaasInstance {
+	return &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels: map[string]string{
+				"rpaas.extensions.tsuru.io/instance-name": name,
+				"rpaas.extensions.tsuru.io/service-name":  "rpaasv2",
+				"rpaas.extensions.tsuru.io/team-owner":    "my-team",
+			},
+			Annotations: map[string]string{
+				"rpaas.extensions.tsuru.io/tags": tags,
+			},
+		},
+	}
+}
+
+// updateTags sets the tags of the instance, retrying on conflicts with the
+// reconciler.
+func updateTags(rpaasInstance *v1alpha1.RpaasInstance, tags string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current := &v1alpha1.RpaasInstance{}
+		err := k8sClient.Get(context.TODO(), client.ObjectKeyFromObject(rpaasInstance), current)
+		if err != nil {
+			return err
+		}
+		current.Annotations["rpaas.extensions.tsuru.io/tags"] = tags
+		return k8sClient.Update(context.TODO(), current)
+	})
+}
+
+// eventuallyRule waits for the PrometheusRule to exist and match.
+func eventuallyRule(t *testing.T, key client.ObjectKey, match func(*monitoringv1.PrometheusRule) bool) *monitoringv1.PrometheusRule {
+	rule := &monitoringv1.PrometheusRule{}
+	require.Eventually(t, func() bool {
+		return k8sClient.Get(context.TODO(), key, rule) == nil && match(rule)
+	}, timeout, interval, "PrometheusRule %s", key)
+	return rule
+}
+
+// eventuallyRemoved waits for the PrometheusRule to be removed.
+func eventuallyRemoved(t *testing.T, key client.ObjectKey) {
+	require.Eventually(t, func() bool {
+		return k8sErrors.IsNotFound(k8sClient.Get(context.TODO(), key, &monitoringv1.PrometheusRule{}))
+	}, timeout, interval, "PrometheusRule %s", key)
+}
@@ -1,18 +1,47 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"text/tabwriter"
 	"text/template"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/go-logr/logr"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	monitoringv1alpha1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
+	"github.com/prometheus/common/model"
 	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	slov1alpha1 "github.com/tsuru/rpaas-slo-controller/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/assign"
+	"github.com/tsuru/rpaas-slo-controller/audit"
+	"github.com/tsuru/rpaas-slo-controller/catalog"
 	"github.com/tsuru/rpaas-slo-controller/controllers"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	"github.com/tsuru/rpaas-slo-controller/recommend"
+	"github.com/tsuru/rpaas-slo-controller/report"
+	"github.com/tsuru/rpaas-slo-controller/sli"
 	"github.com/tsuru/rpaas-slo-controller/webhook"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap/zapcore"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
@@ -23,6 +52,8 @@ var (
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = v1alpha1.AddToScheme(scheme)
 	_ = monitoringv1.AddToScheme(scheme)
+	_ = monitoringv1alpha1.AddToScheme(scheme)
+	_ = slov1alpha1.AddToScheme(scheme)
 )
 
 var (
@@ -31,6 +62,67 @@ var (
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.").
 		Bool()
 
+	leaderElectionID = kingpin.Flag(
+		"leader-election-id", "The name of the resource used for leader election, must be unique for each controller deployment.").
+		Envar("LEADER_ELECTION_ID").
+		Default("65e201d7.tsuru.io").
+		String()
+
+	leaderElectionNamespace = kingpin.Flag(
+		"leader-election-namespace", "The namespace of the leader election lease, defaults to the namespace of the manager pod.").
+		Envar("LEADER_ELECTION_NAMESPACE").
+		String()
+
+	leaseDuration = kingpin.Flag(
+		"lease-duration", "How long non-leader replicas wait before acquiring an expired leadership.").
+		Envar("LEASE_DURATION").
+		Default("15s").
+		Duration()
+
+	renewDeadline = kingpin.Flag(
+		"renew-deadline", "How long the leader retries renewing the leadership before giving it up.").
+		Envar("RENEW_DEADLINE").
+		Default("10s").
+		Duration()
+
+	retryPeriod = kingpin.Flag(
+		"retry-period", "How long replicas wait between leader election attempts.").
+		Envar("RETRY_PERIOD").
+		Default("2s").
+		Duration()
+
+	healthProbeAddr = kingpin.Flag(
+		"health-probe-addr", "The address the liveness (/healthz) and readiness (/readyz) probes bind to.").
+		Envar("HEALTH_PROBE_ADDR").
+		Default(":8081").
+		String()
+
+	webhookAddr = kingpin.Flag(
+		"webhook-addr", "The address the admission webhook binds to.").
+		Envar("WEBHOOK_ADDR").
+		Default(":8888").
+		String()
+
+	webhookCertFile = kingpin.Flag(
+		"webhook-cert-file", "The TLS certificate of the admission webhook, plain HTTP is served when not set.").
+		Envar("WEBHOOK_CERT_FILE").
+		String()
+
+	webhookKeyFile = kingpin.Flag(
+		"webhook-key-file", "The TLS key of the admission webhook.").
+		Envar("WEBHOOK_KEY_FILE").
+		String()
+
+	watchNamespaces = kingpin.Flag(
+		"namespace", "Only watch RpaasInstances on this namespace, may be repeated. Every namespace is watched when omitted.").
+		Envar("WATCH_NAMESPACES").
+		Strings()
+
+	instanceSelector = kingpin.Flag(
+		"instance-selector", "Only reconcile RpaasInstances matching this label selector, eg: environment=prod.").
+		Envar("INSTANCE_SELECTOR").
+		String()
+
 	metricsAddr = kingpin.Flag(
 		"metrics-addr", "The address the metric endpoint binds to.").
 		Envar("METRICS_URL").
@@ -46,51 +138,629 @@ var (
 		"alert-message-template", "The template of alert messages").
 		Envar("ALERT_MESSAGE_TEMPLATE").
 		String()
+
+	outputModes = kingpin.Flag(
+		"output-mode", "The outputs generated for each SLO, may be repeated: "+strings.Join(controllers.OutputModes, ", ")).
+		Envar("OUTPUT_MODES").
+		Default(controllers.OutputPrometheusRules).
+		Enums(controllers.OutputModes...)
+
+	rulesBackend = kingpin.Flag(
+		"rules-backend", "Where the rules of the prometheus-rules output are stored: "+strings.Join(controllers.RulesBackends, ", ")).
+		Envar("RULES_BACKEND").
+		Default(controllers.RulesBackendPrometheusRule).
+		Enum(controllers.RulesBackends...)
+
+	rulerURL = kingpin.Flag(
+		"ruler-url", "The address of the rules API of the ruler backend, eg: http://mimir/prometheus/config/v1/rules.").
+		Envar("RULER_URL").
+		String()
+
+	rulerTenant = kingpin.Flag(
+		"ruler-tenant", "The tenant sent on the X-Scope-OrgID header to the ruler backend.").
+		Envar("RULER_TENANT").
+		String()
+
+	migrateDeprecatedClasses = kingpin.Flag(
+		"migrate-deprecated-classes", "Generate the SLOs of deprecated classes with their replacements.").
+		Envar("MIGRATE_DEPRECATED_CLASSES").
+		Bool()
+
+	alertInhibition = kingpin.Flag(
+		"alert-inhibition", "Generate AlertmanagerConfigs inhibiting the alerts of instances while their dependencies are alerting.").
+		Envar("ALERT_INHIBITION").
+		Bool()
+
+	teamReceiversFile = kingpin.Flag(
+		"team-receivers-file", "YAML file mapping teams to the Alertmanager receivers of their SLO alerts, enables AlertmanagerConfigs per team.").
+		Envar("TEAM_RECEIVERS_FILE").
+		String()
+
+	ruleLabels = kingpin.Flag(
+		"rule-label", "Label added to the generated PrometheusRules as name=template, may be repeated. Templates receive the Pool, Namespace, Class and Team, eg: prometheus=pool-{{ .Pool }}.").
+		Envar("RULE_LABELS").
+		StringMap()
+
+	warnUnselectedRules = kingpin.Flag(
+		"warn-unselected-rules", "Emit a warning event on instances whose PrometheusRules are not selected by any Prometheus.").
+		Envar("WARN_UNSELECTED_RULES").
+		Bool()
+
+	rulesShardMaxSize = kingpin.Flag(
+		"rules-shard-max-size", "Pack the rule groups of the instances into shared PrometheusRules of up to this size in bytes, per rules namespace. Disabled when zero.").
+		Envar("RULES_SHARD_MAX_SIZE").
+		Default("0").
+		Int()
+
+	enableSLOGroups = kingpin.Flag(
+		"enable-slo-groups", "Reconcile RpaasSLOGroups, requires their CRD to be installed.").
+		Envar("ENABLE_SLO_GROUPS").
+		Bool()
+
+	prometheusURL = kingpin.Flag(
+		"prometheus-url", "The address of the Prometheus holding the SLO recording rules.").
+		Envar("PROMETHEUS_URL").
+		String()
+
+	recommendInterval = kingpin.Flag(
+		"recommend-interval", "How often the manager recommends SLO classes, disabled when zero. Requires --prometheus-url.").
+		Envar("RECOMMEND_INTERVAL").
+		Default("0").
+		Duration()
+
+	recommendWindow = kingpin.Flag(
+		"recommend-window", "How far back SLIs are evaluated to recommend SLO classes, eg: 28d.").
+		Envar("RECOMMEND_WINDOW").
+		Default("28d").
+		String()
+
+	webhookAchievability = kingpin.Flag(
+		"webhook-achievability", "Whether the webhook warns about or rejects SLO classes already violated by the instance, its locations or its virtual hosts. Requires --prometheus-url.").
+		Envar("WEBHOOK_ACHIEVABILITY").
+		Default("disabled").
+		Enum("disabled", webhook.AchievabilityWarn, webhook.AchievabilityReject)
+
+	webhookAchievabilityWindow = kingpin.Flag(
+		"webhook-achievability-window", "How far back SLIs are evaluated to check whether a SLO class is achievable, eg: 7d.").
+		Envar("WEBHOOK_ACHIEVABILITY_WINDOW").
+		Default("7d").
+		String()
+
+	webhookAchievabilityTimeout = kingpin.Flag(
+		"webhook-achievability-timeout", "Timeout of the SLO class achievability check, the instance is admitted when exceeded.").
+		Envar("WEBHOOK_ACHIEVABILITY_TIMEOUT").
+		Default("2s").
+		Duration()
+
+	logLevel = kingpin.Flag(
+		"log-level", "The minimum level of the logs.").
+		Envar("LOG_LEVEL").
+		Default("info").
+		Enum("debug", "info", "error")
+
+	logFormat = kingpin.Flag(
+		"log-format", "The format of the logs.").
+		Envar("LOG_FORMAT").
+		Default("json").
+		Enum("json", "console")
+
+	otlpEndpoint = kingpin.Flag(
+		"otlp-endpoint", "The host:port of the OTLP gRPC collector receiving the traces, traces are discarded when empty.").
+		Envar("OTLP_ENDPOINT").
+		String()
+
+	otlpInsecure = kingpin.Flag(
+		"otlp-insecure", "Connect to the OTLP collector without TLS.").
+		Envar("OTLP_INSECURE").
+		Bool()
+
+	traceSampleRatio = kingpin.Flag(
+		"trace-sample-ratio", "The ratio of the reconciliations and reviews traced, unless the parent span is sampled.").
+		Envar("TRACE_SAMPLE_RATIO").
+		Default("1").
+		Float64()
 )
 
+var (
+	runCmd = kingpin.Command("run", "Run the controller manager.").Default()
+
+	reportCmd = kingpin.Command("report", "Report the error budget of the SLOs, grouped by team and pool.")
+
+	reportWindow = reportCmd.Flag(
+		"window", "The window of the error budget, eg: 28d or 30d.").
+		Default("30d").
+		String()
+
+	reportFormat = reportCmd.Flag(
+		"format", "The output format.").
+		Default("table").
+		Enum("table", "json")
+
+	reportTeam = reportCmd.Flag(
+		"team", "Only report SLOs of this team.").
+		String()
+
+	reportPool = reportCmd.Flag(
+		"pool", "Only report SLOs of this pool.").
+		String()
+
+	recommendCmd = kingpin.Command("recommend", "Recommend the strictest SLO class met by each instance.")
+
+	recommendFormat = recommendCmd.Flag(
+		"format", "The output format.").
+		Default("table").
+		Enum("table", "json")
+
+	recommendApply = recommendCmd.Flag(
+		"apply", "Publish the recommendations on the "+recommend.RecommendedClassAnnotation+" annotation.").
+		Bool()
+
+	sloCmd = kingpin.Command("slo", "Manage the SLOs of the instances.")
+
+	sloSetCmd = sloCmd.Command("set", "Set the SLO class of every instance matching the selector.")
+
+	sloSetSelector = sloSetCmd.Flag(
+		"selector", "The instances whose class is set, eg: team=x,pool=y.").
+		Required().
+		String()
+
+	sloSetClass = sloSetCmd.Flag(
+		"class", "The SLO class set on the slo tag of the instances.").
+		Required().
+		String()
+
+	sloSetDryRun = sloSetCmd.Flag(
+		"dry-run", "Only show the changes of the tags.").
+		Bool()
+
+	auditCmd = kingpin.Command("audit", "Audit the SLOs and PrometheusRules of every instance, grouped by team and pool.")
+
+	auditFormat = auditCmd.Flag(
+		"format", "The output format.").
+		Default("table").
+		Enum("table", "json")
+
+	auditDetails = auditCmd.Flag(
+		"details", "List the instances with problems after the table.").
+		Bool()
+)
+
+// newLogger builds the logger of the given level and format, debug logs
+// include the generated SLOs of each reconciliation.
+func newLogger(level, format string) logr.Logger {
+	opts := []zap.Opts{zap.JSONEncoder()}
+	if format == "console" {
+		opts = []zap.Opts{zap.ConsoleEncoder()}
+	}
+
+	switch level {
+	case "debug":
+		opts = append(opts, zap.Level(zapcore.DebugLevel))
+	case "error":
+		opts = append(opts, zap.Level(zapcore.ErrorLevel))
+	default:
+		opts = append(opts, zap.Level(zapcore.InfoLevel))
+	}
+
+	return zap.New(opts...)
+}
+
 func main() {
 	kingpin.Version("0.0.1")
-	kingpin.Parse()
+	command := kingpin.Parse()
+
+	ctrl.SetLogger(newLogger(*logLevel, *logFormat))
+
+	switch command {
+	case reportCmd.FullCommand():
+		runReport()
+	case recommendCmd.FullCommand():
+		runRecommend()
+	case sloSetCmd.FullCommand():
+		runSLOSet()
+	case auditCmd.FullCommand():
+		runAudit()
+	case runCmd.FullCommand():
+		runManager()
+	}
+}
+
+func runReport() {
+	window, err := model.ParseDuration(*reportWindow)
+	if err != nil {
+		kingpin.Fatalf("invalid window: %v", err)
+	}
 
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	sliClient := newSLIClient()
+	k8sClient := newClient()
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	groups, err := report.Generate(context.Background(), newOfflineReconciler(k8sClient, "report"), sliClient, catalog.Filter{
+		Team: *reportTeam,
+		Pool: *reportPool,
+	}, time.Duration(window))
+	if err != nil {
+		kingpin.Fatalf("unable to generate report: %v", err)
+	}
+
+	if *reportFormat == "json" {
+		err = report.WriteJSON(os.Stdout, groups)
+	} else {
+		err = report.WriteTable(os.Stdout, groups)
+	}
+	kingpin.FatalIfError(err, "unable to write report")
+}
+
+func runRecommend() {
+	window, err := model.ParseDuration(*recommendWindow)
+	if err != nil {
+		kingpin.Fatalf("invalid recommend window: %v", err)
+	}
+
+	recommender := &recommend.Recommender{
+		Client: newClient(),
+		SLI:    newSLIClient(),
+		Log:    ctrl.Log.WithName("recommender"),
+		Window: time.Duration(window),
+	}
+
+	recommendations, err := recommender.RecommendAll(context.Background(), *recommendApply)
+	kingpin.FatalIfError(err, "unable to recommend SLO classes")
+
+	if *recommendFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(recommendations)
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "INSTANCE\tCURRENT CLASS\tRECOMMENDED CLASS\tAVAILABILITY")
+		for _, r := range recommendations {
+			availability := "-"
+			if r.Availability != nil {
+				availability = fmt.Sprintf("%.4f%%", *r.Availability)
+			}
+			fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\n", r.Namespace, r.Instance, r.CurrentClass, r.RecommendedClass, availability)
+		}
+		err = tw.Flush()
+	}
+	kingpin.FatalIfError(err, "unable to write recommendations")
+}
+
+func runSLOSet() {
+	selector, err := assign.ParseSelector(*sloSetSelector)
+	if err != nil {
+		kingpin.Fatalf("invalid selector: %v", err)
+	}
+
+	changes, err := assign.SetClass(context.Background(), newClient(), selector, *sloSetClass, *sloSetDryRun)
+	if werr := assign.WriteDiff(os.Stdout, changes); werr != nil {
+		kingpin.Fatalf("unable to write changes: %v", werr)
+	}
+	kingpin.FatalIfError(err, "unable to set SLO class")
+
+	if len(changes) == 0 {
+		fmt.Println("no instances changed")
+	}
+}
+
+func runAudit() {
+	k8sClient := newClient()
+	auditor := &audit.Auditor{
+		Client:     k8sClient,
+		Reconciler: newOfflineReconciler(k8sClient, "audit"),
+	}
+
+	result, err := auditor.Audit(context.Background())
+	kingpin.FatalIfError(err, "unable to audit instances")
+
+	if *auditFormat == "json" {
+		err = audit.WriteJSON(os.Stdout, result)
+	} else {
+		err = audit.WriteTable(os.Stdout, result, *auditDetails)
+	}
+	kingpin.FatalIfError(err, "unable to write audit")
+}
+
+// newOfflineReconciler returns a reconciler generating the same SLOs and
+// rules as the manager, to be inspected out of it.
+func newOfflineReconciler(k8sClient client.Client, name string) *controllers.RpaasInstanceReconciler {
+	alertLinkTpl, alertMessageTpl := alertTemplates()
+
+	prometheusRuleLabels, err := controllers.ParseRuleLabels(*ruleLabels)
+	if err != nil {
+		kingpin.Fatalf("invalid rule labels: %v", err)
+	}
+
+	backend, err := newRulesBackend(k8sClient)
+	if err != nil {
+		kingpin.Fatalf("invalid rules backend: %v", err)
+	}
+
+	return &controllers.RpaasInstanceReconciler{
+		AlertLinkTemplate:        alertLinkTpl,
+		AlertMessageTemplate:     alertMessageTpl,
+		OutputModes:              *outputModes,
+		MigrateDeprecatedClasses: *migrateDeprecatedClasses,
+		RuleLabels:               prometheusRuleLabels,
+		RulesBackend:             backend,
+		RulesShardMaxSize:        *rulesShardMaxSize,
+		Client:                   k8sClient,
+		Log:                      ctrl.Log.WithName(name),
+	}
+}
+
+// newRulesBackend returns the rules backend chosen by --rules-backend, nil
+// stands for the default one.
+func newRulesBackend(k8sClient client.Client) (controllers.RulesBackend, error) {
+	switch *rulesBackend {
+	case controllers.RulesBackendConfigMap:
+		return &controllers.ConfigMapRulesBackend{
+			Client: k8sClient,
+			Log:    ctrl.Log.WithName("backends").WithName("ConfigMap"),
+		}, nil
+	case controllers.RulesBackendRuler:
+		if *rulerURL == "" {
+			return nil, fmt.Errorf("--ruler-url is required")
+		}
+		return &controllers.RulerRulesBackend{
+			URL:    strings.TrimSuffix(*rulerURL, "/"),
+			Tenant: *rulerTenant,
+			Client: &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// alertTemplates parses the alert link and message templates, if any.
+func alertTemplates() (link, message *template.Template) {
+	if alertLinkTemplate != nil {
+		link = template.Must(template.New("link").Parse(*alertLinkTemplate))
+	}
+
+	if alertMessageTemplate != nil {
+		message = template.Must(template.New("message").Parse(*alertMessageTemplate))
+	}
+
+	return link, message
+}
+
+func newSLIClient() *sli.Client {
+	if *prometheusURL == "" {
+		kingpin.Fatalf("required flag --prometheus-url not provided")
+	}
+
+	sliClient, err := sli.NewClient(*prometheusURL)
+	if err != nil {
+		kingpin.Fatalf("invalid Prometheus URL: %v", err)
+	}
+
+	return sliClient
+}
+
+// newTracerProvider returns the provider exporting the traces to the OTLP
+// collector, or a no-op provider when there is none.
+func newTracerProvider(ctx context.Context) (trace.TracerProvider, func(context.Context) error, error) {
+	if *otlpEndpoint == "" {
+		return trace.NewNoopTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(*otlpEndpoint)}
+	if *otlpInsecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(*traceSampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("rpaas-slo-controller"),
+		)),
+	)
+
+	return provider, provider.Shutdown, nil
+}
+
+func newClient() client.Client {
+	k8sClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		kingpin.Fatalf("unable to create kubernetes client: %v", err)
+	}
+
+	return k8sClient
+}
+
+func runManager() {
+	selector, err := labels.Parse(*instanceSelector)
+	if err != nil {
+		kingpin.Fatalf("invalid instance selector: %v", err)
+	}
+
+	// the classes are compiled in, so they are only validated once
+	if err := definition.ValidateClasses(); err != nil {
+		setupLog.Error(err, "invalid SLO classes definition")
+		os.Exit(1)
+	}
+
+	options := ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: *metricsAddr,
 		Port:               9443,
 		LeaderElection:     *enableLeaderElection,
-		LeaderElectionID:   "65e201d7.tsuru.io",
-	})
+		LeaderElectionID:   *leaderElectionID,
+
+		LeaderElectionNamespace: *leaderElectionNamespace,
+		LeaseDuration:           leaseDuration,
+		RenewDeadline:           renewDeadline,
+		RetryPeriod:             retryPeriod,
+		HealthProbeBindAddress:  *healthProbeAddr,
+	}
+	if len(*watchNamespaces) > 0 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(controllers.CacheNamespaces(*watchNamespaces))
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	var alertLinkTpl *template.Template
-	if alertLinkTemplate != nil {
-		alertLinkTpl = template.Must(template.New("link").Parse(*alertLinkTemplate))
+	tracerProvider, shutdownTracing, err := newTracerProvider(context.Background())
+	if err != nil {
+		setupLog.Error(err, "unable to start tracing")
+		os.Exit(1)
 	}
+	defer shutdownTracing(context.Background())
 
-	var alertMessageTpl *template.Template
-	if alertMessageTemplate != nil {
-		alertMessageTpl = template.Must(template.New("message").Parse(*alertMessageTemplate))
+	alertLinkTpl, alertMessageTpl := alertTemplates()
+
+	prometheusRuleLabels, err := controllers.ParseRuleLabels(*ruleLabels)
+	if err != nil {
+		setupLog.Error(err, "unable to parse rule labels")
+		os.Exit(1)
+	}
 
+	backend, err := newRulesBackend(mgr.GetClient())
+	if err != nil {
+		setupLog.Error(err, "unable to set up the rules backend")
+		os.Exit(1)
+	}
+
+	var teamReceivers *controllers.TeamReceivers
+	if *teamReceiversFile != "" {
+		teamReceivers, err = controllers.LoadTeamReceivers(*teamReceiversFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load team receivers")
+			os.Exit(1)
+		}
 	}
 
-	if err = (&controllers.RpaasInstanceReconciler{
-		AlertLinkTemplate:    alertLinkTpl,
-		AlertMessageTemplate: alertMessageTpl,
+	instanceReconciler := &controllers.RpaasInstanceReconciler{
+		AlertLinkTemplate:        alertLinkTpl,
+		AlertMessageTemplate:     alertMessageTpl,
+		OutputModes:              *outputModes,
+		MigrateDeprecatedClasses: *migrateDeprecatedClasses,
+		AlertInhibition:          *alertInhibition,
+		InstanceSelector:         selector,
+		RuleLabels:               prometheusRuleLabels,
+		WarnUnselectedRules:      *warnUnselectedRules,
+		RulesBackend:             backend,
+		RulesShardMaxSize:        *rulesShardMaxSize,
+		TracerProvider:           tracerProvider,
 
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("RpaasInstanceReconciler"),
-	}).SetupWithManager(mgr); err != nil {
+		APIReader: mgr.GetAPIReader(),
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("controllers").WithName("RpaasInstanceReconciler"),
+		Recorder:  mgr.GetEventRecorderFor("rpaas-slo-controller"),
+	}
+	if err = instanceReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "RpaasInstance")
 		os.Exit(1)
 	}
 
+	if teamReceivers != nil {
+		if err = (&controllers.TeamAlertsReconciler{
+			TeamReceivers:    teamReceivers,
+			InstanceSelector: selector,
+			Client:           mgr.GetClient(),
+			Log:              ctrl.Log.WithName("controllers").WithName("TeamAlertsReconciler"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "TeamAlerts")
+			os.Exit(1)
+		}
+	}
+
+	if *enableSLOGroups {
+		if err = (&controllers.RpaasSLOGroupReconciler{
+			InstanceSelector: selector,
+			RuleLabels:       prometheusRuleLabels,
+			Client:           mgr.GetClient(),
+			Log:              ctrl.Log.WithName("controllers").WithName("RpaasSLOGroupReconciler"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "RpaasSLOGroup")
+			os.Exit(1)
+		}
+	}
+
+	if *recommendInterval > 0 {
+		window, err := model.ParseDuration(*recommendWindow)
+		if err != nil {
+			kingpin.Fatalf("invalid recommend window: %v", err)
+		}
+
+		if err = mgr.Add(&recommend.Recommender{
+			Client:   mgr.GetClient(),
+			SLI:      newSLIClient(),
+			Recorder: mgr.GetEventRecorderFor("rpaas-slo-recommender"),
+			Log:      ctrl.Log.WithName("recommender"),
+			Window:   time.Duration(window),
+			Interval: *recommendInterval,
+		}); err != nil {
+			setupLog.Error(err, "unable to add SLO class recommender")
+			os.Exit(1)
+		}
+	}
+
 	// +kubebuilder:scaffold:builder
-	setupLog.Info("starting mutation webhook")
-	go webhook.Run()
+	if err = mgr.AddMetricsExtraHandler(catalog.Path, catalog.NewHandler(instanceReconciler, ctrl.Log.WithName("catalog"))); err != nil {
+		setupLog.Error(err, "unable to register SLO catalog handler")
+		os.Exit(1)
+	}
+
+	var achievability *webhook.AchievabilityCheck
+	if *webhookAchievability != "disabled" {
+		window, err := model.ParseDuration(*webhookAchievabilityWindow)
+		if err != nil {
+			kingpin.Fatalf("invalid webhook achievability window: %v", err)
+		}
+
+		achievability = &webhook.AchievabilityCheck{
+			SLI:     newSLIClient(),
+			Mode:    *webhookAchievability,
+			Window:  time.Duration(window),
+			Timeout: *webhookAchievabilityTimeout,
+		}
+	}
+
+	webhookServer := &webhook.Server{
+		Addr:          *webhookAddr,
+		Achievability: achievability,
+		Log:           ctrl.Log.WithName("webhook"),
+		CertFile:      *webhookCertFile,
+		KeyFile:       *webhookKeyFile,
+
+		TracerProvider: tracerProvider,
+	}
+	if err = mgr.Add(webhookServer); err != nil {
+		setupLog.Error(err, "unable to add mutation webhook")
+		os.Exit(1)
+	}
+
+	for name, check := range map[string]healthz.Checker{
+		"ping":    healthz.Ping,
+		"webhook": webhookServer.Check,
+	} {
+		if err = mgr.AddHealthzCheck(name, check); err != nil {
+			setupLog.Error(err, "unable to add liveness check", "check", name)
+			os.Exit(1)
+		}
+	}
+
+	for name, check := range map[string]healthz.Checker{
+		"cache":     controllers.CacheSyncCheck(mgr.GetCache()),
+		"webhook":   webhookServer.Check,
+		"templates": instanceReconciler.TemplatesCheck,
+	} {
+		if err = mgr.AddReadyzCheck(name, check); err != nil {
+			setupLog.Error(err, "unable to add readiness check", "check", name)
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
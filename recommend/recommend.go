@@ -0,0 +1,200 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/globocom/slo-generator/slo"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/common/model"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	"github.com/tsuru/rpaas-slo-controller/definition"
+	"github.com/tsuru/rpaas-slo-controller/sli"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RecommendedClassAnnotation holds the SLO class recommended for the instance.
+const RecommendedClassAnnotation = "rpaas.extensions.tsuru.io/recommended-slo-class"
+
+// Recommendation is the strictest SLO class met by an instance over a window,
+// RecommendedClass is empty when no class would be met or there is no data.
+type Recommendation struct {
+	Instance         string   `json:"instance"`
+	Namespace        string   `json:"namespace"`
+	CurrentClass     string   `json:"currentClass"`
+	RecommendedClass string   `json:"recommendedClass"`
+	Availability     *float64 `json:"availability"`
+}
+
+// Recommend finds the strictest class whose objectives were met by the
+// instance over the window, deprecated classes are never recommended.
+// Latency objectives are evaluated out of the latency histogram of the
+// instance, since the latency SLIs are only recorded for the buckets of the
+// class in use. Objectives whose bucket is not on the histogram are evaluated
+// with the nearest lower bucket, and considered violated when there is none.
+func Recommend(ctx context.Context, sliClient *sli.Client, rpaasInstance *v1alpha1.RpaasInstance, window time.Duration) (Recommendation, error) {
+	recommendation := Recommendation{
+		Instance:  rpaasInstance.Name,
+		Namespace: rpaasInstance.Namespace,
+	}
+
+	if current, _ := definition.SLOClass(rpaasInstance); current != nil {
+		recommendation.CurrentClass = current.Name
+	}
+
+	service := controllers.InstanceSLOName(rpaasInstance)
+	errorRatio, found, err := sliClient.ErrorRatio(ctx, service, window)
+	if err != nil {
+		return recommendation, err
+	}
+	if !found {
+		return recommendation, nil
+	}
+
+	availability := (1 - errorRatio) * 100
+	recommendation.Availability = &availability
+
+	var buckets map[float64]float64
+	for _, class := range definition.Classes() {
+		if definition.Replacement(&class) != nil {
+			continue
+		}
+		if availability < class.Objectives.Availability {
+			continue
+		}
+
+		if buckets == nil && len(class.Objectives.Latency) > 0 {
+			histogram, matchers := controllers.InstanceLatencyHistogram(rpaasInstance)
+			buckets, err = sliClient.LatencyBuckets(ctx, histogram, matchers, window)
+			if err != nil {
+				return recommendation, err
+			}
+		}
+
+		met, err := latencyMet(class, buckets)
+		if err != nil {
+			return recommendation, err
+		}
+		if met {
+			recommendation.RecommendedClass = class.Name
+			break
+		}
+	}
+
+	return recommendation, nil
+}
+
+func latencyMet(class slo.Class, buckets map[float64]float64) (bool, error) {
+	for _, latency := range class.Objectives.Latency {
+		le, err := strconv.ParseFloat(latency.LE, 64)
+		if err != nil {
+			return false, fmt.Errorf("class %q has invalid bucket %q: %w", class.Name, latency.LE, err)
+		}
+
+		lower, _ := sli.LatencyRatioBounds(buckets, le)
+		if lower*100 < latency.Target {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Recommender recommends SLO classes for every RpaasInstance, publishing them
+// on RecommendedClassAnnotation and as events.
+type Recommender struct {
+	Client   client.Client
+	SLI      *sli.Client
+	Recorder record.EventRecorder
+	Log      logr.Logger
+
+	// Window is how far back the SLIs are evaluated.
+	Window time.Duration
+	// Interval between recommendations when running as a manager Runnable.
+	Interval time.Duration
+}
+
+// Start recommends classes every Interval until the context is done.
+func (r *Recommender) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := r.RecommendAll(ctx, true)
+		if err != nil {
+			r.Log.Error(err, "could not recommend SLO classes")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecommendAll recommends a class for every RpaasInstance, publishing the
+// changed recommendations when publish is set.
+func (r *Recommender) RecommendAll(ctx context.Context, publish bool) ([]Recommendation, error) {
+	instances := v1alpha1.RpaasInstanceList{}
+	err := r.Client.List(ctx, &instances)
+	if err != nil {
+		return nil, err
+	}
+
+	var recommendations []Recommendation
+	for i := range instances.Items {
+		rpaasInstance := &instances.Items[i]
+		recommendation, err := Recommend(ctx, r.SLI, rpaasInstance, r.Window)
+		if err != nil {
+			r.Log.Error(err, "could not recommend SLO class",
+				"name", rpaasInstance.Name,
+				"namespace", rpaasInstance.Namespace,
+			)
+			continue
+		}
+		recommendations = append(recommendations, recommendation)
+
+		if !publish || recommendation.RecommendedClass == "" {
+			continue
+		}
+
+		err = r.publish(ctx, rpaasInstance, recommendation)
+		if err != nil {
+			r.Log.Error(err, "could not publish SLO class recommendation",
+				"name", rpaasInstance.Name,
+				"namespace", rpaasInstance.Namespace,
+			)
+		}
+	}
+
+	return recommendations, nil
+}
+
+func (r *Recommender) publish(ctx context.Context, rpaasInstance *v1alpha1.RpaasInstance, recommendation Recommendation) error {
+	if rpaasInstance.Annotations[RecommendedClassAnnotation] == recommendation.RecommendedClass {
+		return nil
+	}
+
+	patch := client.MergeFrom(rpaasInstance.DeepCopy())
+	if rpaasInstance.Annotations == nil {
+		rpaasInstance.Annotations = map[string]string{}
+	}
+	rpaasInstance.Annotations[RecommendedClassAnnotation] = recommendation.RecommendedClass
+	err := r.Client.Patch(ctx, rpaasInstance, patch)
+	if err != nil {
+		return err
+	}
+
+	if r.Recorder != nil {
+		r.Recorder.Event(rpaasInstance, corev1.EventTypeNormal, "SLOClassRecommended",
+			fmt.Sprintf("SLO class %q is recommended (current: %q), based on the last %s", recommendation.RecommendedClass, recommendation.CurrentClass, model.Duration(r.Window)))
+	}
+
+	return nil
+}
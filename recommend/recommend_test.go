@@ -0,0 +1,147 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/sli"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newFakePrometheus answers the queries with the scalar results or, for
+// histogram queries, with a series for each bucket.
+func newFakePrometheus(t *testing.T, results map[string]string, buckets map[string]map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		query := r.Form.Get("query")
+		if value, found := results[query]; found {
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1634000000,%q]}]}}`, value)
+			return
+		}
+
+		var series []string
+		for le, value := range buckets[query] {
+			series = append(series, fmt.Sprintf(`{"metric":{"le":%q},"value":[1634000000,%q]}`, le, value))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, strings.Join(series, ","))
+	}))
+}
+
+func newSLIClient(t *testing.T, results map[string]string, buckets map[string]map[string]string) *sli.Client {
+	prometheus := newFakePrometheus(t, results, buckets)
+	t.Cleanup(prometheus.Close)
+
+	sliClient, err := sli.NewClient(prometheus.URL)
+	require.NoError(t, err)
+	return sliClient
+}
+
+func histogramQuery(name string) string {
+	return fmt.Sprintf(`sum by (le) (rate(nginx_vts_server_request_duration_seconds_bucket{namespace="default",rpaas_instance=%[1]q,host="*"}[4w])) / ignoring (le) group_left sum(rate(nginx_vts_server_request_duration_seconds_count{namespace="default",rpaas_instance=%[1]q,host="*"}[4w]))`, name)
+}
+
+func newInstance(name, tags string) *v1alpha1.RpaasInstance {
+	return &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Annotations: map[string]string{
+				"rpaas.extensions.tsuru.io/tags": tags,
+			},
+		},
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	sliClient := newSLIClient(t, map[string]string{
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance1"}[4w])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance1"}[4w]))`:                     "0.0005",
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance2"}[4w])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance2"}[4w]))`:                     "0.0001",
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance3"}[4w])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance3"}[4w]))`:                     "0.05",
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance-coarse"}[4w])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance-coarse"}[4w]))`:         "0",
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance-no-latency"}[4w])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance-no-latency"}[4w]))`: "0",
+	}, map[string]map[string]string{
+		histogramQuery("instance1"): {"0.1": "0.97", "0.2": "0.995", "0.5": "0.999", "1": "0.9995", "+Inf": "1"},
+		// the buckets of stricter classes are measured, even if not recorded
+		// for the class in use
+		histogramQuery("instance2"):       {"0.05": "0.9", "0.1": "0.96", "0.2": "0.995", "+Inf": "1"},
+		histogramQuery("instance3"):       {"0.1": "1", "+Inf": "1"},
+		histogramQuery("instance-coarse"): {"0.25": "0.999", "1": "1", "+Inf": "1"},
+	})
+
+	tests := []struct {
+		instance *v1alpha1.RpaasInstance
+		expected string
+	}{
+		{instance: newInstance("instance1", "slo:critical"), expected: "high_fast"},
+		{instance: newInstance("instance2", "slo:low"), expected: "critical"},
+		{instance: newInstance("instance3", "slo:high"), expected: ""},
+		{instance: newInstance("instance-coarse", "slo:high"), expected: "high"},
+		{instance: newInstance("instance-no-latency", ""), expected: "medium"},
+		{instance: newInstance("instance-no-data", ""), expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.instance.Name, func(t *testing.T) {
+			recommendation, err := Recommend(context.TODO(), sliClient, tt.instance, 28*24*time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, recommendation.RecommendedClass)
+		})
+	}
+}
+
+func TestRecommenderPublish(t *testing.T) {
+	sliClient := newSLIClient(t, map[string]string{
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance1"}[1w])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance1"}[1w]))`: "0.005",
+	}, nil)
+
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+	k8sClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(newInstance("instance1", "slo:high"), newInstance("instance2", "slo:low")).
+		Build()
+
+	recorder := record.NewFakeRecorder(10)
+	recommender := &Recommender{
+		Client:   k8sClient,
+		SLI:      sliClient,
+		Recorder: recorder,
+		Log:      ctrl.Log,
+		Window:   7 * 24 * time.Hour,
+	}
+
+	recommendations, err := recommender.RecommendAll(context.TODO(), true)
+	require.NoError(t, err)
+	assert.Len(t, recommendations, 2)
+
+	rpaasInstance := &v1alpha1.RpaasInstance{}
+	err = k8sClient.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "instance1"}, rpaasInstance)
+	require.NoError(t, err)
+	assert.Equal(t, "medium", rpaasInstance.Annotations[RecommendedClassAnnotation])
+	assert.Equal(t, "slo:high", rpaasInstance.Annotations["rpaas.extensions.tsuru.io/tags"])
+
+	err = k8sClient.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "instance2"}, rpaasInstance)
+	require.NoError(t, err)
+	assert.NotContains(t, rpaasInstance.Annotations, RecommendedClassAnnotation)
+
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, `Normal SLOClassRecommended SLO class "medium" is recommended (current: "high"), based on the last 1w`, <-recorder.Events)
+
+	_, err = recommender.RecommendAll(context.TODO(), true)
+	require.NoError(t, err)
+	assert.Len(t, recorder.Events, 0)
+}
@@ -0,0 +1,153 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tsuru/rpaas-slo-controller/catalog"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	"github.com/tsuru/rpaas-slo-controller/sli"
+)
+
+// Group holds the error budget reports of the SLOs of a team in a pool.
+type Group struct {
+	Team string      `json:"team"`
+	Pool string      `json:"pool"`
+	SLOs []SLOReport `json:"slos"`
+}
+
+// SLOReport is the error budget status of a SLO over the report window,
+// fields without data are left nil. Error holds why the SLIs of the SLO
+// could not be queried.
+type SLOReport struct {
+	Instance        string   `json:"instance"`
+	Namespace       string   `json:"namespace"`
+	SLO             string   `json:"slo"`
+	Class           string   `json:"class"`
+	Availability    float64  `json:"availability"`
+	ErrorRatio      *float64 `json:"errorRatio"`
+	BudgetConsumed  *float64 `json:"budgetConsumed"`
+	BudgetRemaining *float64 `json:"budgetRemaining"`
+	BurnRate        *float64 `json:"burnRate"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// Generate reports the error budget of every SLO matching the filter over
+// the window, grouped by team and pool. SLOs whose SLIs cannot be queried are
+// reported with the error.
+func Generate(ctx context.Context, reconciler *controllers.RpaasInstanceReconciler, sliClient *sli.Client, filter catalog.Filter, window time.Duration) ([]Group, error) {
+	entries, err := catalog.List(ctx, reconciler, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []Group{}
+	groupIndex := map[[2]string]int{}
+	for _, entry := range entries {
+		if entry.Class == "" {
+			continue
+		}
+
+		sloReport, err := generateSLOReport(ctx, sliClient, entry, window)
+		if err != nil {
+			sloReport.Error = err.Error()
+		}
+
+		key := [2]string{entry.Team, entry.Pool}
+		i, found := groupIndex[key]
+		if !found {
+			i = len(groups)
+			groupIndex[key] = i
+			groups = append(groups, Group{Team: entry.Team, Pool: entry.Pool})
+		}
+		groups[i].SLOs = append(groups[i].SLOs, sloReport)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Team != groups[j].Team {
+			return groups[i].Team < groups[j].Team
+		}
+		return groups[i].Pool < groups[j].Pool
+	})
+
+	return groups, nil
+}
+
+func generateSLOReport(ctx context.Context, sliClient *sli.Client, entry catalog.Entry, window time.Duration) (SLOReport, error) {
+	sloReport := SLOReport{
+		Instance:     entry.Instance,
+		Namespace:    entry.Namespace,
+		SLO:          entry.SLO,
+		Class:        entry.Class,
+		Availability: entry.Objectives.Availability,
+	}
+
+	budget := 1 - entry.Objectives.Availability/100
+	errorRatio, found, err := sliClient.ErrorRatio(ctx, entry.SLO, window)
+	if err != nil {
+		return sloReport, fmt.Errorf("could not query error ratio of %s: %w", entry.SLO, err)
+	}
+	if found {
+		consumed := errorRatio / budget
+		remaining := 1 - consumed
+		sloReport.ErrorRatio = &errorRatio
+		sloReport.BudgetConsumed = &consumed
+		sloReport.BudgetRemaining = &remaining
+	}
+
+	currentErrorRatio, found, err := sliClient.CurrentErrorRatio(ctx, entry.SLO)
+	if err != nil {
+		return sloReport, fmt.Errorf("could not query current error ratio of %s: %w", entry.SLO, err)
+	}
+	if found {
+		burnRate := currentErrorRatio / budget
+		sloReport.BurnRate = &burnRate
+	}
+
+	return sloReport, nil
+}
+
+// WriteJSON writes the groups as JSON.
+func WriteJSON(w io.Writer, groups []Group) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(groups)
+}
+
+// WriteTable writes the groups as a human readable table.
+func WriteTable(w io.Writer, groups []Group) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TEAM\tPOOL\tINSTANCE\tSLO\tCLASS\tOBJECTIVE\tERROR RATIO\tBUDGET CONSUMED\tBUDGET REMAINING\tBURN RATE\tERROR")
+	for _, group := range groups {
+		for _, s := range group.SLOs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%g%%\t%s\t%s\t%s\t%s\t%s\n",
+				group.Team, group.Pool, s.Namespace+"/"+s.Instance, s.SLO, s.Class, s.Availability,
+				formatRatio(s.ErrorRatio, 100, "%.4f%%"),
+				formatRatio(s.BudgetConsumed, 100, "%.1f%%"),
+				formatRatio(s.BudgetRemaining, 100, "%.1f%%"),
+				formatRatio(s.BurnRate, 1, "%.2f"),
+				formatError(s.Error),
+			)
+		}
+	}
+	return tw.Flush()
+}
+
+func formatError(err string) string {
+	if err == "" {
+		return "-"
+	}
+	return err
+}
+
+func formatRatio(value *float64, multiplier float64, format string) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf(format, *value*multiplier)
+}
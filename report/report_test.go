@@ -0,0 +1,191 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/catalog"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	"github.com/tsuru/rpaas-slo-controller/sli"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newFakePrometheus(t *testing.T, results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		query := r.Form.Get("query")
+
+		w.Header().Set("Content-Type", "application/json")
+		value, found := results[query]
+		if !found {
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1634000000,%q]}]}}`, value)
+	}))
+}
+
+func newFakeReader() *fake.ClientBuilder {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	instance := func(namespace, name, team, tags string) *v1alpha1.RpaasInstance {
+		return &v1alpha1.RpaasInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Labels: map[string]string{
+					"rpaas.extensions.tsuru.io/team-owner": team,
+				},
+				Annotations: map[string]string{
+					"rpaas.extensions.tsuru.io/tags": tags,
+				},
+			},
+		}
+	}
+
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			instance("rpaasv2-fe-pool1", "instance1", "team-b", "slo:critical"),
+			instance("rpaasv2-be-pool1", "instance2", "team-a", "slo:high"),
+			instance("default", "instance3", "team-a", "slo:low"),
+			instance("default", "instance4", "team-a", ""),
+		)
+}
+
+func newReconciler() *controllers.RpaasInstanceReconciler {
+	return &controllers.RpaasInstanceReconciler{
+		Client: newFakeReader().Build(),
+		Log:    ctrl.Log,
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	prometheus := newFakePrometheus(t, map[string]string{
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.rpaasv2-fe-pool1.instance1"}[30d])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.rpaasv2-fe-pool1.instance1"}[30d]))`: "0.00005",
+		`avg(slo:service_errors_total:ratio_rate_1h{service="tsuru.rpaasv2-fe-pool1.instance1"})`:                                                                                                                                     "0.0002",
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.rpaasv2-be-pool1.instance2"}[30d])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.rpaasv2-be-pool1.instance2"}[30d]))`: "0.002",
+		`avg(slo:service_errors_total:ratio_rate_1h{service="tsuru.rpaasv2-be-pool1.instance2"})`:                                                                                                                                     "0",
+	})
+	defer prometheus.Close()
+
+	sliClient, err := sli.NewClient(prometheus.URL)
+	require.NoError(t, err)
+
+	groups, err := Generate(context.TODO(), newReconciler(), sliClient, catalog.Filter{}, 30*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, groups, 3)
+
+	assert.Equal(t, "team-a", groups[0].Team)
+	assert.Equal(t, "", groups[0].Pool)
+	require.Len(t, groups[0].SLOs, 1)
+	assert.Equal(t, "tsuru.default.instance3", groups[0].SLOs[0].SLO)
+	assert.Nil(t, groups[0].SLOs[0].ErrorRatio)
+	assert.Nil(t, groups[0].SLOs[0].BurnRate)
+
+	assert.Equal(t, "team-a", groups[1].Team)
+	assert.Equal(t, "pool1", groups[1].Pool)
+	require.Len(t, groups[1].SLOs, 1)
+	assert.InDelta(t, 2.0, *groups[1].SLOs[0].BudgetConsumed, 0.0001)
+	assert.InDelta(t, -1.0, *groups[1].SLOs[0].BudgetRemaining, 0.0001)
+	assert.InDelta(t, 0.0, *groups[1].SLOs[0].BurnRate, 0.0001)
+
+	assert.Equal(t, "team-b", groups[2].Team)
+	require.Len(t, groups[2].SLOs, 1)
+	assert.InDelta(t, 0.5, *groups[2].SLOs[0].BudgetConsumed, 0.0001)
+	assert.InDelta(t, 0.5, *groups[2].SLOs[0].BudgetRemaining, 0.0001)
+	assert.InDelta(t, 2.0, *groups[2].SLOs[0].BurnRate, 0.0001)
+
+	var buf bytes.Buffer
+	err = WriteTable(&buf, groups)
+	require.NoError(t, err)
+	assert.Equal(t, `TEAM    POOL   INSTANCE                    SLO                               CLASS     OBJECTIVE  ERROR RATIO  BUDGET CONSUMED  BUDGET REMAINING  BURN RATE  ERROR
+team-a         default/instance3           tsuru.default.instance3           low       98%        -            -                -                 -          -
+team-a  pool1  rpaasv2-be-pool1/instance2  tsuru.rpaasv2-be-pool1.instance2  high      99.9%      0.2000%      200.0%           -100.0%           0.00       -
+team-b  pool1  rpaasv2-fe-pool1/instance1  tsuru.rpaasv2-fe-pool1.instance1  critical  99.99%     0.0050%      50.0%            50.0%             2.00       -
+`, buf.String())
+}
+
+func TestGenerateQueryError(t *testing.T) {
+	// every query of instance1 returns a series for each of its classes
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.Contains(r.Form.Get("query"), "tsuru.rpaasv2-fe-pool1.instance1") {
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"slo_class":"high"},"value":[1634000000,"0.001"]},
+			{"metric":{"slo_class":"critical"},"value":[1634000000,"0.0001"]}
+		]}}`)
+	}))
+	defer prometheus.Close()
+
+	sliClient, err := sli.NewClient(prometheus.URL)
+	require.NoError(t, err)
+
+	groups, err := Generate(context.TODO(), newReconciler(), sliClient, catalog.Filter{}, 30*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, groups, 3)
+
+	require.Len(t, groups[1].SLOs, 1)
+	assert.Equal(t, "tsuru.rpaasv2-be-pool1.instance2", groups[1].SLOs[0].SLO)
+	assert.Empty(t, groups[1].SLOs[0].Error)
+
+	require.Len(t, groups[2].SLOs, 1)
+	assert.Equal(t, "tsuru.rpaasv2-fe-pool1.instance1", groups[2].SLOs[0].SLO)
+	assert.Nil(t, groups[2].SLOs[0].ErrorRatio)
+	assert.Contains(t, groups[2].SLOs[0].Error, "could not query error ratio of tsuru.rpaasv2-fe-pool1.instance1")
+	assert.Contains(t, groups[2].SLOs[0].Error, "returned 2 series, expected one")
+}
+
+func TestGenerateFilter(t *testing.T) {
+	prometheus := newFakePrometheus(t, nil)
+	defer prometheus.Close()
+
+	sliClient, err := sli.NewClient(prometheus.URL)
+	require.NoError(t, err)
+
+	groups, err := Generate(context.TODO(), newReconciler(), sliClient, catalog.Filter{Team: "team-b"}, 28*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "team-b", groups[0].Team)
+
+	var buf bytes.Buffer
+	err = WriteJSON(&buf, groups)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{
+			"team": "team-b",
+			"pool": "pool1",
+			"slos": [
+				{
+					"instance": "instance1",
+					"namespace": "rpaasv2-fe-pool1",
+					"slo": "tsuru.rpaasv2-fe-pool1.instance1",
+					"class": "critical",
+					"availability": 99.99,
+					"errorRatio": null,
+					"budgetConsumed": null,
+					"budgetRemaining": null,
+					"burnRate": null
+				}
+			]
+		}
+	]`, buf.String())
+}
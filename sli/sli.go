@@ -0,0 +1,145 @@
+package sli
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// Querier is the subset of the Prometheus API used to query SLIs.
+type Querier interface {
+	Query(ctx context.Context, query string, ts time.Time) (model.Value, promv1.Warnings, error)
+}
+
+// Client queries the SLIs recorded for the SLOs, using the same recording
+// rules referenced by the generated alerts, eg:
+// slo:service_errors_total:ratio_rate_1h{service="tsuru.default.my-instance"}.
+type Client struct {
+	API Querier
+}
+
+// NewClient returns a Client of the Prometheus available on address.
+func NewClient(address string) (*Client, error) {
+	c, err := api.NewClient(api.Config{Address: address})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{API: promv1.NewAPI(c)}, nil
+}
+
+// ErrorRatio returns the mean error ratio of the service over the window, the
+// boolean result is false when there is no data.
+func (c *Client) ErrorRatio(ctx context.Context, service string, window time.Duration) (float64, bool, error) {
+	return c.scalar(ctx, meanOverTime(fmt.Sprintf(`slo:service_errors_total:ratio_rate_1h{service=%q}`, service), window))
+}
+
+// CurrentErrorRatio returns the error ratio of the service in the last hour.
+func (c *Client) CurrentErrorRatio(ctx context.Context, service string) (float64, bool, error) {
+	return c.scalar(ctx, fmt.Sprintf(`avg(slo:service_errors_total:ratio_rate_1h{service=%q})`, service))
+}
+
+// LatencyRatio returns the mean ratio of requests served within le seconds
+// over the window, the boolean result is false when there is no data.
+func (c *Client) LatencyRatio(ctx context.Context, service, le string, window time.Duration) (float64, bool, error) {
+	return c.scalar(ctx, meanOverTime(fmt.Sprintf(`slo:service_latency:ratio_rate_1h{service=%q,le=%q}`, service, le), window))
+}
+
+// Ratio returns the single ratio evaluated by the query, the boolean result
+// is false when there is no data.
+func (c *Client) Ratio(ctx context.Context, query string) (float64, bool, error) {
+	return c.scalar(ctx, query)
+}
+
+// meanOverTime returns the query of the mean of the selected SLI over the
+// window. The recording rules of a SLO carry the class and the labels of the
+// rules, so a SLO changed within the window has several series, which are
+// weighted by their samples.
+func meanOverTime(selector string, window time.Duration) string {
+	return fmt.Sprintf(`sum(sum_over_time(%[1]s[%[2]s])) / sum(count_over_time(%[1]s[%[2]s]))`, selector, model.Duration(window))
+}
+
+// LatencyBuckets returns the ratio of requests served within each bucket of
+// the histogram over the window, keyed by the upper bound of the bucket. The
+// result is empty when there is no data.
+func (c *Client) LatencyBuckets(ctx context.Context, histogram, matchers string, window time.Duration) (map[float64]float64, error) {
+	query := fmt.Sprintf(`sum by (le) (rate(%[1]s_bucket{%[2]s}[%[3]s])) / ignoring (le) group_left sum(rate(%[1]s_count{%[2]s}[%[3]s]))`,
+		histogram, matchers, model.Duration(window))
+	value, _, err := c.API.Query(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	vector, ok := value.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("query %q returned unexpected %s result", query, value.Type())
+	}
+
+	buckets := map[float64]float64{}
+	for _, sample := range vector {
+		le, err := strconv.ParseFloat(string(sample.Metric[model.BucketLabel]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("query %q returned invalid bucket: %w", query, err)
+		}
+		if math.IsNaN(float64(sample.Value)) {
+			continue
+		}
+		buckets[le] = float64(sample.Value)
+	}
+
+	return buckets, nil
+}
+
+// LatencyRatioBounds returns bounds of the ratio of requests served within
+// le, given the ratios of the buckets of a histogram: the ratio of the
+// largest bucket up to le (0 when there is none) and the ratio of the
+// smallest bucket from le (1 when there is none). Both are the same when le
+// is a bucket of the histogram.
+func LatencyRatioBounds(buckets map[float64]float64, le float64) (lower, upper float64) {
+	lowerLE, upperLE := math.Inf(-1), math.Inf(1)
+	lower, upper = 0, 1
+	for bucket, ratio := range buckets {
+		if bucket <= le && bucket > lowerLE {
+			lowerLE, lower = bucket, ratio
+		}
+		if bucket >= le && bucket <= upperLE {
+			upperLE, upper = bucket, ratio
+		}
+	}
+	return lower, upper
+}
+
+func (c *Client) scalar(ctx context.Context, query string) (float64, bool, error) {
+	value, _, err := c.API.Query(ctx, query, time.Now())
+	if err != nil {
+		return 0, false, err
+	}
+
+	var sample model.SampleValue
+	switch v := value.(type) {
+	case model.Vector:
+		if len(v) == 0 {
+			return 0, false, nil
+		}
+		if len(v) > 1 {
+			return 0, false, fmt.Errorf("query %q returned %d series, expected one", query, len(v))
+		}
+		sample = v[0].Value
+	case *model.Scalar:
+		sample = v.Value
+	default:
+		return 0, false, fmt.Errorf("query %q returned unexpected %s result", query, value.Type())
+	}
+
+	if math.IsNaN(float64(sample)) {
+		return 0, false, nil
+	}
+
+	return float64(sample), true, nil
+}
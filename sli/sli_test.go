@@ -0,0 +1,84 @@
+package sli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// engineQuerier evaluates the queries on the series loaded by a promql test,
+// at a fixed time.
+type engineQuerier struct {
+	test *promql.Test
+	ts   time.Time
+}
+
+func (q *engineQuerier) Query(ctx context.Context, query string, _ time.Time) (model.Value, promv1.Warnings, error) {
+	qry, err := q.test.QueryEngine().NewInstantQuery(q.test.Queryable(), query, q.ts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer qry.Close()
+
+	result := qry.Exec(ctx)
+	if result.Err != nil {
+		return nil, nil, result.Err
+	}
+
+	vector, err := result.Vector()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value := model.Vector{}
+	for _, sample := range vector {
+		metric := model.Metric{}
+		for _, label := range sample.Metric {
+			metric[model.LabelName(label.Name)] = model.LabelValue(label.Value)
+		}
+		value = append(value, &model.Sample{Metric: metric, Value: model.SampleValue(sample.V)})
+	}
+
+	return value, nil, nil
+}
+
+func TestClientSeriesOfChangedSLO(t *testing.T) {
+	// the class of the SLO changed after an hour
+	test, err := promql.NewTest(t, `
+load 1m
+  slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance1",slo_class="high"} 0.01x59
+  slo:service_errors_total:ratio_rate_1h{service="tsuru.default.instance1",slo_class="critical"} _x59 0.03x59
+  slo:service_latency:ratio_rate_1h{service="tsuru.default.instance1",le="0.200",slo_class="high"} 0.9x59
+  slo:service_latency:ratio_rate_1h{service="tsuru.default.instance1",le="0.200",slo_class="critical"} _x59 0.7x59
+`)
+	require.NoError(t, err)
+	defer test.Close()
+	require.NoError(t, test.Run())
+
+	client := &Client{API: &engineQuerier{test: test, ts: time.Unix(0, 0).Add(119 * time.Minute)}}
+
+	errorRatio, found, err := client.ErrorRatio(context.TODO(), "tsuru.default.instance1", 2*time.Hour)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.InDelta(t, 0.02, errorRatio, 0.0001)
+
+	currentErrorRatio, found, err := client.CurrentErrorRatio(context.TODO(), "tsuru.default.instance1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.InDelta(t, 0.03, currentErrorRatio, 0.0001)
+
+	latencyRatio, found, err := client.LatencyRatio(context.TODO(), "tsuru.default.instance1", "0.200", 2*time.Hour)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.InDelta(t, 0.8, latencyRatio, 0.0001)
+
+	_, found, err = client.ErrorRatio(context.TODO(), "tsuru.default.instance2", 2*time.Hour)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/controllers"
+	"github.com/tsuru/rpaas-slo-controller/sli"
+)
+
+const (
+	// AchievabilityWarn adds admission warnings for classes already violated.
+	AchievabilityWarn = "warn"
+	// AchievabilityReject rejects classes already violated.
+	AchievabilityReject = "reject"
+)
+
+// AchievabilityCheck validates whether the SLO class requested for an
+// instance would have been met by its recent performance. Any failure to
+// query the SLIs, including timeouts, admits the instance.
+type AchievabilityCheck struct {
+	SLI *sli.Client
+	// Mode is either AchievabilityWarn or AchievabilityReject.
+	Mode string
+	// Window is how far back the SLIs are evaluated.
+	Window time.Duration
+	// Timeout of the whole check.
+	Timeout time.Duration
+}
+
+// objectiveResult is an objective of a SLO found violated or that could not
+// be evaluated.
+type objectiveResult struct {
+	// SLO describes the class of the SLO and what it measures, eg:
+	// SLO class "critical" of location "/api".
+	SLO     string
+	Message string
+}
+
+// violations returns the objectives of the SLOs of the instance violated in
+// the window, only for the SLOs whose class is being changed, and the
+// objectives that could not be evaluated.
+func (c *AchievabilityCheck) violations(ctx context.Context, review *kwhmodel.AdmissionReview, rpaasInstance *v1alpha1.RpaasInstance) (violations, unknown []objectiveResult, err error) {
+	slos, _ := controllers.InstanceSLOs(rpaasInstance, nil)
+	previous := previousClasses(review)
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	for _, s := range slos {
+		if class, found := previous[s.SLO.Name]; found && class == s.Class.Name {
+			continue
+		}
+
+		sloViolations, sloUnknown, err := c.sloViolations(ctx, s)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		description := sloDescription(s)
+		for _, message := range sloViolations {
+			violations = append(violations, objectiveResult{SLO: description, Message: message})
+		}
+		for _, message := range sloUnknown {
+			unknown = append(unknown, objectiveResult{SLO: description, Message: message})
+		}
+	}
+
+	return violations, unknown, nil
+}
+
+// sloViolations returns the objectives of the SLO violated in the window and
+// the objectives that could not be evaluated. Latency objectives are
+// evaluated out of the latency histogram of the SLO, since the latency SLIs
+// are only recorded for the buckets of the class in use.
+func (c *AchievabilityCheck) sloViolations(ctx context.Context, s controllers.InstanceSLO) (violations, unknown []string, err error) {
+	class := s.Class
+
+	var errorRatio float64
+	var found bool
+	if s.SLO.ErrorRateRecord.Expr != "" {
+		// SLIs recorded by the SLO itself only exist once it has a class
+		errorRatio, found, err = c.SLI.Ratio(ctx, s.SLO.ErrorRateRecord.ComputeExpr(model.Duration(c.Window).String(), ""))
+	} else {
+		errorRatio, found, err = c.SLI.ErrorRatio(ctx, s.SLO.Name, c.Window)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if found && (1-errorRatio)*100 < class.Objectives.Availability {
+		violations = append(violations, fmt.Sprintf("availability was %.4f%%, below the %g%% objective", (1-errorRatio)*100, class.Objectives.Availability))
+	}
+
+	if len(class.Objectives.Latency) == 0 {
+		return violations, nil, nil
+	}
+
+	histogram, matchers := s.LatencyHistogram()
+	buckets, err := c.SLI.LatencyBuckets(ctx, histogram, matchers, c.Window)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(buckets) == 0 {
+		return violations, nil, nil
+	}
+
+	for _, latency := range class.Objectives.Latency {
+		le, err := strconv.ParseFloat(latency.LE, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// without the bucket of the objective, the ratio is only known to be
+		// between the ratios of the nearest buckets
+		lower, upper := sli.LatencyRatioBounds(buckets, le)
+		switch {
+		case lower == upper && lower*100 < latency.Target:
+			violations = append(violations, fmt.Sprintf("%.2f%% of requests were served within %ss, below the %g%% objective", lower*100, latency.LE, latency.Target))
+		case upper*100 < latency.Target:
+			violations = append(violations, fmt.Sprintf("at most %.2f%% of requests were served within %ss, below the %g%% objective", upper*100, latency.LE, latency.Target))
+		case lower*100 < latency.Target:
+			unknown = append(unknown, fmt.Sprintf("between %.2f%% and %.2f%% of requests were served within %ss, the latency histogram has no such bucket", lower*100, upper*100, latency.LE))
+		}
+	}
+
+	return violations, unknown, nil
+}
+
+// sloDescription describes the class of a SLO along with the location or the
+// virtual host it measures.
+func sloDescription(s controllers.InstanceSLO) string {
+	switch {
+	case s.SLO.Labels["rpaas_location"] != "":
+		return fmt.Sprintf("SLO class %q of location %q", s.Class.Name, s.SLO.Labels["rpaas_location"])
+	case s.SLO.Labels["rpaas_host"] != "":
+		return fmt.Sprintf("SLO class %q of host %q", s.Class.Name, s.SLO.Labels["rpaas_host"])
+	}
+
+	return fmt.Sprintf("SLO class %q", s.Class.Name)
+}
+
+// previousClasses returns the class of each SLO of the instance before the
+// change under review, keyed by the SLO name. Nothing is returned on
+// creations.
+func previousClasses(review *kwhmodel.AdmissionReview) map[string]string {
+	if review == nil || len(review.OldObjectRaw) == 0 {
+		return nil
+	}
+
+	old := &v1alpha1.RpaasInstance{}
+	if err := json.Unmarshal(review.OldObjectRaw, old); err != nil {
+		return nil
+	}
+
+	slos, _ := controllers.InstanceSLOs(old, nil)
+	classes := map[string]string{}
+	for _, s := range slos {
+		classes[s.SLO.Name] = s.Class.Name
+	}
+
+	return classes
+}
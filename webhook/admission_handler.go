@@ -2,42 +2,158 @@ package webhook
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"github.com/prometheus/common/model"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
 	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
 	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
 	kwhvalidating "github.com/slok/kubewebhook/v2/pkg/webhook/validating"
 	"github.com/tsuru/rpaas-operator/api/v1alpha1"
 	"github.com/tsuru/rpaas-slo-controller/definition"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-type rpaasV1Validator struct{}
+const tracerName = "github.com/tsuru/rpaas-slo-controller/webhook"
 
-func (d *rpaasV1Validator) Validate(_ context.Context, _ *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhvalidating.ValidatorResult, error) {
+type rpaasV1Validator struct {
+	achievability *AchievabilityCheck
+	logger        kwhlog.Logger
+	tracer        trace.Tracer
+}
+
+func (d *rpaasV1Validator) startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := d.tracer
+	if tracer == nil {
+		tracer = trace.NewNoopTracerProvider().Tracer(tracerName)
+	}
+
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+func (d *rpaasV1Validator) Validate(ctx context.Context, review *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhvalidating.ValidatorResult, error) {
 	rpaasInstance, ok := obj.(*v1alpha1.RpaasInstance)
 	if !ok {
 		// If not a rpaasInstance just continue the validation chain(if there is one) and don't do nothing.
 		return &kwhvalidating.ValidatorResult{Valid: true}, nil
 	}
 
+	class := definition.SLOClassName(rpaasInstance)
+	logger := d.logger.WithCtxValues(ctx).WithValues(kwhlog.Kv{
+		"instance":  rpaasInstance.Name,
+		"namespace": rpaasInstance.Namespace,
+		"class":     class,
+	})
+
+	ctx, span := d.startSpan(ctx, "ValidateRpaasInstance",
+		attribute.String("instance", rpaasInstance.Name),
+		attribute.String("namespace", rpaasInstance.Namespace),
+		attribute.String("class", class),
+	)
+	defer span.End()
+
+	result := d.validate(ctx, logger, review, rpaasInstance)
+	span.SetAttributes(
+		attribute.Bool("valid", result.Valid),
+		attribute.Int("warnings", len(result.Warnings)),
+	)
+	switch {
+	case !result.Valid:
+		logger.Infof("rejected RpaasInstance: %s", result.Message)
+	case len(result.Warnings) > 0:
+		logger.Infof("allowed RpaasInstance with warnings: %s", strings.Join(result.Warnings, "; "))
+	default:
+		logger.Debugf("allowed RpaasInstance")
+	}
+
+	return result, nil
+}
+
+func (d *rpaasV1Validator) validate(ctx context.Context, logger kwhlog.Logger, review *kwhmodel.AdmissionReview, rpaasInstance *v1alpha1.RpaasInstance) *kwhvalidating.ValidatorResult {
 	_, err := definition.SLOClass(rpaasInstance)
 	if err != nil {
 		return &kwhvalidating.ValidatorResult{
 			Valid:   false,
 			Message: "Invalid SLO class",
-		}, nil
+		}
+	}
+
+	_, err = definition.LocationSLOClasses(rpaasInstance)
+	if err != nil {
+		return &kwhvalidating.ValidatorResult{
+			Valid:   false,
+			Message: "Invalid location SLO classes: " + err.Error(),
+		}
+	}
+
+	_, err = definition.HostSLOClasses(rpaasInstance)
+	if err != nil {
+		return &kwhvalidating.ValidatorResult{
+			Valid:   false,
+			Message: "Invalid virtual host SLO classes: " + err.Error(),
+		}
+	}
+
+	_, err = definition.SLOSchedule(rpaasInstance)
+	if err != nil {
+		return &kwhvalidating.ValidatorResult{
+			Valid:   false,
+			Message: "Invalid SLO schedule: " + err.Error(),
+		}
+	}
+
+	result := &kwhvalidating.ValidatorResult{Valid: true}
+	if d.achievability != nil {
+		spanCtx, span := d.startSpan(ctx, "CheckAchievability")
+		violations, unknown, err := d.achievability.violations(spanCtx, review, rpaasInstance)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		if err != nil {
+			// fail open, the instance must not be blocked by an unavailable Prometheus
+			logger.Warningf("could not check whether the SLO classes are achievable: %v", err)
+		}
+
+		for _, violation := range violations {
+			message := fmt.Sprintf("%s would not have been met in the last %s: %s", violation.SLO, model.Duration(d.achievability.Window), violation.Message)
+			if d.achievability.Mode == AchievabilityReject {
+				return &kwhvalidating.ValidatorResult{
+					Valid:   false,
+					Message: message,
+				}
+			}
+			result.Warnings = append(result.Warnings, message)
+		}
+		for _, objective := range unknown {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s could not be fully checked in the last %s: %s", objective.SLO, model.Duration(d.achievability.Window), objective.Message))
+		}
+	}
+
+	for _, deprecation := range definition.Deprecations(rpaasInstance) {
+		result.Warnings = append(result.Warnings, deprecation.String())
 	}
 
-	return &kwhvalidating.ValidatorResult{Valid: true}, nil
+	return result
 }
 
-func NewRpaasInstancesWebhook(logger kwhlog.Logger) (kwhwebhook.Webhook, error) {
+// NewRpaasInstancesWebhook returns the webhook validating RpaasInstances,
+// the achievability of SLO classes is only checked when achievability is set.
+func NewRpaasInstancesWebhook(logger kwhlog.Logger, tracer trace.Tracer, achievability *AchievabilityCheck) (kwhwebhook.Webhook, error) {
 	return kwhvalidating.NewWebhook(
 		kwhvalidating.WebhookConfig{
-			ID:        "webhook-rpaasInstanceValidator",
-			Obj:       &v1alpha1.RpaasInstance{},
-			Validator: &rpaasV1Validator{},
-			Logger:    logger,
+			ID:  "webhook-rpaasInstanceValidator",
+			Obj: &v1alpha1.RpaasInstance{},
+			Validator: &rpaasV1Validator{
+				achievability: achievability,
+				logger:        logger,
+				tracer:        tracer,
+			},
+			Logger: logger,
 		})
 }
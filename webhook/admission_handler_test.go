@@ -0,0 +1,325 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/rpaas-operator/api/v1alpha1"
+	"github.com/tsuru/rpaas-slo-controller/sli"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newFakePrometheus answers the queries with the scalar results or, for
+// histogram queries, with a series for each bucket.
+func newFakePrometheus(t *testing.T, results map[string]string, buckets map[string]map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		query := r.Form.Get("query")
+
+		w.Header().Set("Content-Type", "application/json")
+		if value, found := results[query]; found {
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1634000000,%q]}]}}`, value)
+			return
+		}
+
+		var series []string
+		for le, value := range buckets[query] {
+			series = append(series, fmt.Sprintf(`{"metric":{"le":%q},"value":[1634000000,%q]}`, le, value))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, strings.Join(series, ","))
+	}))
+}
+
+func newInstance(tags string) *v1alpha1.RpaasInstance {
+	return &v1alpha1.RpaasInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "my-instance",
+			Annotations: map[string]string{
+				"rpaas.extensions.tsuru.io/tags": tags,
+			},
+		},
+	}
+}
+
+func TestValidateAchievability(t *testing.T) {
+	prometheus := newFakePrometheus(t, map[string]string{
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.my-instance"}[1w])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.my-instance"}[1w]))`: "0.0005",
+	}, map[string]map[string]string{
+		`sum by (le) (rate(nginx_vts_server_request_duration_seconds_bucket{namespace="default",rpaas_instance="my-instance",host="*"}[1w])) / ignoring (le) group_left sum(rate(nginx_vts_server_request_duration_seconds_count{namespace="default",rpaas_instance="my-instance",host="*"}[1w]))`: {
+			"0.05": "0.9", "0.1": "0.94", "0.25": "0.999", "1": "1", "+Inf": "1",
+		},
+	})
+	defer prometheus.Close()
+
+	sliClient, err := sli.NewClient(prometheus.URL)
+	require.NoError(t, err)
+
+	oldHigh, err := json.Marshal(newInstance("slo:high"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		mode         string
+		tags         string
+		oldObjectRaw []byte
+		valid        bool
+		message      string
+		warnings     []string
+	}{
+		{
+			name:  "achievable class",
+			mode:  AchievabilityReject,
+			tags:  "slo:medium",
+			valid: true,
+		},
+		{
+			name:  "achievable latency from lower buckets",
+			mode:  AchievabilityReject,
+			tags:  "slo:high",
+			valid: true,
+		},
+		{
+			name:  "violated class with warn mode",
+			mode:  AchievabilityWarn,
+			tags:  "slo:critical",
+			valid: true,
+			warnings: []string{
+				`SLO class "critical" would not have been met in the last 1w: availability was 99.9500%, below the 99.99% objective`,
+				`SLO class "critical" would not have been met in the last 1w: 94.00% of requests were served within 0.100s, below the 95% objective`,
+				`SLO class "critical" could not be fully checked in the last 1w: between 94.00% and 99.90% of requests were served within 0.200s, the latency histogram has no such bucket`,
+			},
+		},
+		{
+			name:    "violated latency with reject mode",
+			mode:    AchievabilityReject,
+			tags:    "slo:high_fast",
+			valid:   false,
+			message: `SLO class "high_fast" would not have been met in the last 1w: 94.00% of requests were served within 0.100s, below the 95% objective`,
+		},
+		{
+			name:    "violated class with reject mode",
+			mode:    AchievabilityReject,
+			tags:    "slo:critical",
+			valid:   false,
+			message: `SLO class "critical" would not have been met in the last 1w: availability was 99.9500%, below the 99.99% objective`,
+		},
+		{
+			name:         "unchanged class",
+			mode:         AchievabilityReject,
+			tags:         "slo:high",
+			oldObjectRaw: oldHigh,
+			valid:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := &rpaasV1Validator{
+				achievability: &AchievabilityCheck{
+					SLI:     sliClient,
+					Mode:    tt.mode,
+					Window:  7 * 24 * time.Hour,
+					Timeout: time.Second,
+				},
+				logger: kwhlog.Noop,
+			}
+
+			review := &kwhmodel.AdmissionReview{OldObjectRaw: tt.oldObjectRaw}
+			result, err := validator.Validate(context.TODO(), review, newInstance(tt.tags))
+			require.NoError(t, err)
+			assert.Equal(t, tt.valid, result.Valid)
+			assert.Equal(t, tt.message, result.Message)
+			assert.Equal(t, tt.warnings, result.Warnings)
+		})
+	}
+}
+
+func TestValidateAchievabilityLocationsAndHosts(t *testing.T) {
+	location := `namespace="default",rpaas_instance="my-instance",filter="location",filter_name="/api"`
+	host := `namespace="default",rpaas_instance="my-instance",host="example.com"`
+	prometheus := newFakePrometheus(t, map[string]string{
+		`sum(sum_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.my-instance"}[1w])) / sum(count_over_time(slo:service_errors_total:ratio_rate_1h{service="tsuru.default.my-instance"}[1w]))`: "0.01",
+		`sum(rate(nginx_vts_filter_requests_total{` + location + `,direction="5xx"}[1w])) / sum(rate(nginx_vts_filter_requests_total{` + location + `,direction="total"}[1w]))`:                                       "0.0005",
+		`sum(rate(nginx_vts_server_requests_total{` + host + `,code="5xx"}[1w])) / sum(rate(nginx_vts_server_requests_total{` + host + `,code="total"}[1w]))`:                                                         "0",
+	}, map[string]map[string]string{
+		`sum by (le) (rate(nginx_vts_filter_request_duration_seconds_bucket{` + location + `}[1w])) / ignoring (le) group_left sum(rate(nginx_vts_filter_request_duration_seconds_count{` + location + `}[1w]))`: {
+			"0.1": "0.99", "0.2": "0.999", "+Inf": "1",
+		},
+		`sum by (le) (rate(nginx_vts_server_request_duration_seconds_bucket{` + host + `}[1w])) / ignoring (le) group_left sum(rate(nginx_vts_server_request_duration_seconds_count{` + host + `}[1w]))`: {
+			"0.5": "0.9", "1": "0.95", "+Inf": "1",
+		},
+	})
+	defer prometheus.Close()
+
+	sliClient, err := sli.NewClient(prometheus.URL)
+	require.NoError(t, err)
+
+	old := newInstance("slo:critical")
+	old.Spec.Locations = []v1alpha1.Location{{Path: "/api", Destination: "api"}}
+	old.Annotations["rpaas.extensions.tsuru.io/slo-locations"] = `{"/api": "medium"}`
+	oldObjectRaw, err := json.Marshal(old)
+	require.NoError(t, err)
+
+	instance := old.DeepCopy()
+	instance.Annotations["rpaas.extensions.tsuru.io/slo-locations"] = `{"/api": "critical"}`
+	instance.Annotations["rpaas.extensions.tsuru.io/slo-hosts"] = `{"example.com": "high"}`
+
+	validator := &rpaasV1Validator{
+		achievability: &AchievabilityCheck{
+			SLI:     sliClient,
+			Mode:    AchievabilityWarn,
+			Window:  7 * 24 * time.Hour,
+			Timeout: time.Second,
+		},
+		logger: kwhlog.Noop,
+	}
+
+	result, err := validator.Validate(context.TODO(), &kwhmodel.AdmissionReview{OldObjectRaw: oldObjectRaw}, instance)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, []string{
+		`SLO class "critical" of location "/api" would not have been met in the last 1w: availability was 99.9500%, below the 99.99% objective`,
+		`SLO class "high" of host "example.com" would not have been met in the last 1w: 95.00% of requests were served within 1.000s, below the 99% objective`,
+		`SLO class "high" of host "example.com" would not have been met in the last 1w: 90.00% of requests were served within 0.500s, below the 95% objective`,
+	}, result.Warnings)
+}
+
+func TestValidateAchievabilityFailsOpen(t *testing.T) {
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer prometheus.Close()
+
+	sliClient, err := sli.NewClient(prometheus.URL)
+	require.NoError(t, err)
+
+	validator := &rpaasV1Validator{
+		achievability: &AchievabilityCheck{
+			SLI:     sliClient,
+			Mode:    AchievabilityReject,
+			Window:  7 * 24 * time.Hour,
+			Timeout: 50 * time.Millisecond,
+		},
+		logger: kwhlog.Noop,
+	}
+
+	result, err := validator.Validate(context.TODO(), &kwhmodel.AdmissionReview{}, newInstance("slo:critical"))
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Warnings)
+}
+
+func TestValidateDeprecatedClasses(t *testing.T) {
+	validator := &rpaasV1Validator{logger: kwhlog.Noop}
+
+	instance := newInstance("slo:high_slow")
+	instance.Annotations["rpaas.extensions.tsuru.io/slo-locations"] = `{"/api": "high_slow", "/static": "low"}`
+
+	result, err := validator.Validate(context.TODO(), &kwhmodel.AdmissionReview{}, instance)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, []string{
+		`SLO class "high_slow" of tag is deprecated, use "high" instead`,
+		`SLO class "high_slow" of location "/api" is deprecated, use "high" instead`,
+	}, result.Warnings)
+}
+
+func TestValidateSchedule(t *testing.T) {
+	validator := &rpaasV1Validator{logger: kwhlog.Noop}
+
+	tests := []struct {
+		tags     string
+		schedule string
+		message  string
+	}{
+		{
+			tags:     "slo:medium",
+			schedule: `{"timezone": "America/Sao_Paulo", "windows": [{"days": ["mon-fri"], "hours": "9-18", "class": "critical"}]}`,
+		},
+		{
+			tags:     "",
+			schedule: `{"timezone": "America/Sao_Paulo", "windows": [{"days": ["mon-fri"], "hours": "9-18", "class": "critical"}]}`,
+			message:  "Invalid SLO schedule: rpaas.extensions.tsuru.io/slo-schedule annotation requires a slo tag, whose class is in force out of the windows",
+		},
+		{
+			tags:     "slo:medium",
+			schedule: `{"timezone": "Mars/Olympus_Mons", "windows": [{"hours": "9-18", "class": "critical"}]}`,
+			message:  `Invalid SLO schedule: invalid timezone "Mars/Olympus_Mons": unknown time zone Mars/Olympus_Mons`,
+		},
+		{
+			tags:     "slo:medium",
+			schedule: `{"timezone": "UTC", "windows": [{"days": ["mon-fry"], "class": "critical"}]}`,
+			message:  `Invalid SLO schedule: window 0: invalid day "fry"`,
+		},
+		{
+			tags:     "slo:medium",
+			schedule: `{"timezone": "UTC", "windows": [{"hours": "9-25", "class": "critical"}]}`,
+			message:  `Invalid SLO schedule: window 0: invalid hour "25"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			instance := newInstance(tt.tags)
+			instance.Annotations["rpaas.extensions.tsuru.io/slo-schedule"] = tt.schedule
+
+			result, err := validator.Validate(context.TODO(), &kwhmodel.AdmissionReview{}, instance)
+			require.NoError(t, err)
+			assert.Equal(t, tt.message == "", result.Valid)
+			assert.Equal(t, tt.message, result.Message)
+		})
+	}
+}
+
+func TestValidateTracing(t *testing.T) {
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer prometheus.Close()
+
+	sliClient, err := sli.NewClient(prometheus.URL)
+	require.NoError(t, err)
+
+	exporter := tracetest.NewInMemoryExporter()
+	validator := &rpaasV1Validator{
+		achievability: &AchievabilityCheck{
+			SLI:     sliClient,
+			Mode:    AchievabilityWarn,
+			Window:  7 * 24 * time.Hour,
+			Timeout: time.Second,
+		},
+		logger: kwhlog.Noop,
+		tracer: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer(tracerName),
+	}
+
+	_, err = validator.Validate(context.TODO(), &kwhmodel.AdmissionReview{}, newInstance("slo:critical"))
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	check, review := spans[0], spans[1]
+
+	assert.Equal(t, "CheckAchievability", check.Name)
+	assert.Equal(t, codes.Error, check.Status.Code)
+	assert.Equal(t, review.SpanContext.SpanID(), check.Parent.SpanID())
+
+	assert.Equal(t, "ValidateRpaasInstance", review.Name)
+	assert.Contains(t, review.Attributes, attribute.String("instance", "my-instance"))
+	assert.Contains(t, review.Attributes, attribute.String("class", "critical"))
+	assert.Contains(t, review.Attributes, attribute.Bool("valid", true))
+}
@@ -1,24 +1,132 @@
 package webhook
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/go-logr/logr"
 	kwhhttp "github.com/slok/kubewebhook/v2/pkg/http"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func Run() {
-	logger := kwhlog.Noop
-	webhook, err := NewRpaasInstancesWebhook(logger)
+// checkTimeout is how long the health check waits to connect to the webhook.
+const checkTimeout = time.Second
+
+// Server serves the admission webhook. It runs on every replica, regardless
+// of the leader election.
+type Server struct {
+	Addr          string
+	Achievability *AchievabilityCheck
+	Log           logr.Logger
+	// CertFile and KeyFile serve the webhook over TLS, plain HTTP is served
+	// when not set.
+	CertFile string
+	KeyFile  string
+	// TracerProvider traces the reviews, the global provider is used when nil.
+	TracerProvider trace.TracerProvider
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// Start serves the webhook until the context is done.
+func (s *Server) Start(ctx context.Context) error {
+	var logger kwhlog.Logger = kwhlog.Noop
+	if s.Log != nil {
+		logger = NewLogger(s.Log)
+	}
+	tracerProvider := s.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	webhook, err := NewRpaasInstancesWebhook(logger, tracerProvider.Tracer(tracerName), s.Achievability)
 	if err != nil {
-		log.Fatal("Could not instantiate webhook", err)
-		return
+		return err
 	}
 	webhookHandler, err := kwhhttp.HandlerFor(kwhhttp.HandlerConfig{Webhook: webhook, Logger: logger})
 	if err != nil {
-		log.Fatal("Could not instantiate webhook handler", err)
-		return
+		return err
+	}
+
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.listener = nil
+		s.mu.Unlock()
+	}()
+
+	server := &http.Server{Handler: traceContextHandler(webhookHandler)}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	if s.CertFile != "" || s.KeyFile != "" {
+		err = server.ServeTLS(listener, s.CertFile, s.KeyFile)
+	} else {
+		err = server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// traceContextHandler continues the traces of the API server, when sent on
+// the W3C traceparent header.
+func traceContextHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := propagation.TraceContext{}.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// NeedLeaderElection tells the manager to run the webhook on every replica.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Check fails when the webhook is not accepting connections.
+func (s *Server) Check(_ *http.Request) error {
+	s.mu.Lock()
+	listener := s.listener
+	s.mu.Unlock()
+
+	if listener == nil {
+		return errors.New("webhook is not listening")
+	}
+
+	dialer := &net.Dialer{Timeout: checkTimeout}
+	if s.CertFile != "" || s.KeyFile != "" {
+		// completes the handshake, avoiding errors logged on every check; only
+		// the local server is reached, its certificate is not verified
+		conn, err := tls.DialWithDialer(dialer, "tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	conn, err := dialer.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		return err
 	}
-	log.Fatal(http.ListenAndServe(":8888", webhookHandler))
+	return conn.Close()
 }
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerCheck(t *testing.T) {
+	server := &Server{Addr: "127.0.0.1:0"}
+	assert.EqualError(t, server.Check(&http.Request{}), "webhook is not listening")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- server.Start(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return server.Check(&http.Request{}) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, server.NeedLeaderElection())
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook server did not stop")
+	}
+	assert.Error(t, server.Check(&http.Request{}))
+}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 to dir.
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "rpaas-slo-controller"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestServerTLS(t *testing.T) {
+	certFile, keyFile, pool := writeCertificate(t, t.TempDir())
+	server := &Server{Addr: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		return server.Check(&http.Request{}) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	server.mu.Lock()
+	addr := server.listener.Addr().String()
+	server.mu.Unlock()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Post("https://"+addr+"/", "application/json", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.NotNil(t, resp.TLS)
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+)
+
+// NewLogger adapts a logr.Logger to the logger of kubewebhook. Since logr has
+// no warning level, warnings are logged as info with severity=warning, not
+// to clash with the level key of the JSON encoder, and debug messages on
+// verbosity 1.
+func NewLogger(log logr.Logger) kwhlog.Logger {
+	return logger{log: log}
+}
+
+type logger struct {
+	log logr.Logger
+}
+
+func (l logger) Infof(format string, args ...interface{}) {
+	l.log.Info(fmt.Sprintf(format, args...))
+}
+
+func (l logger) Warningf(format string, args ...interface{}) {
+	l.log.Info(fmt.Sprintf(format, args...), "severity", "warning")
+}
+
+func (l logger) Errorf(format string, args ...interface{}) {
+	l.log.Error(nil, fmt.Sprintf(format, args...))
+}
+
+func (l logger) Debugf(format string, args ...interface{}) {
+	l.log.V(1).Info(fmt.Sprintf(format, args...))
+}
+
+func (l logger) WithValues(values kwhlog.Kv) kwhlog.Logger {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	keysAndValues := make([]interface{}, 0, 2*len(keys))
+	for _, key := range keys {
+		keysAndValues = append(keysAndValues, key, values[key])
+	}
+
+	return logger{log: l.log.WithValues(keysAndValues...)}
+}
+
+func (l logger) WithCtxValues(ctx context.Context) kwhlog.Logger {
+	return l.WithValues(kwhlog.ValuesFromCtx(ctx))
+}
+
+func (l logger) SetValuesOnCtx(parent context.Context, values kwhlog.Kv) context.Context {
+	return kwhlog.CtxWithValues(parent, values)
+}
@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLogger keeps every log line, with its key/value pairs, as text.
+type recordingLogger struct {
+	lines         *[]string
+	keysAndValues []interface{}
+	verbosity     int
+}
+
+func (l recordingLogger) Enabled() bool { return l.verbosity == 0 }
+
+func (l recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	if l.Enabled() {
+		l.record("info", msg, keysAndValues)
+	}
+}
+
+func (l recordingLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.record("error", msg, keysAndValues)
+}
+
+func (l recordingLogger) V(level int) logr.Logger {
+	l.verbosity += level
+	return l
+}
+
+func (l recordingLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	l.keysAndValues = append(append([]interface{}{}, l.keysAndValues...), keysAndValues...)
+	return l
+}
+
+func (l recordingLogger) WithName(name string) logr.Logger { return l }
+
+func (l recordingLogger) record(level, msg string, keysAndValues []interface{}) {
+	*l.lines = append(*l.lines, fmt.Sprint(level, " ", msg, " ", append(append([]interface{}{}, l.keysAndValues...), keysAndValues...)))
+}
+
+func TestLogger(t *testing.T) {
+	var lines []string
+	logger := NewLogger(recordingLogger{lines: &lines})
+
+	logger = logger.WithValues(map[string]interface{}{"namespace": "default", "instance": "my-instance"})
+	logger.Infof("allowed %s", "RpaasInstance")
+	logger.Warningf("could not check: %v", "timeout")
+	logger.Errorf("failed")
+	logger.Debugf("hidden")
+
+	assert.Equal(t, []string{
+		"info allowed RpaasInstance [instance my-instance namespace default]",
+		"info could not check: timeout [instance my-instance namespace default severity warning]",
+		"error failed [instance my-instance namespace default]",
+	}, lines)
+}
+
+func TestValidateLogsInstance(t *testing.T) {
+	var lines []string
+	validator := &rpaasV1Validator{logger: NewLogger(recordingLogger{lines: &lines})}
+
+	result, err := validator.Validate(context.TODO(), &kwhmodel.AdmissionReview{}, newInstance("slo:invalid"))
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "info rejected RpaasInstance: "+result.Message+" [class invalid instance my-instance namespace default]", lines[0])
+}